@@ -0,0 +1,113 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/discovery"
+)
+
+// ResolveCacheConfig configures the cache of the instances resolved by a polaris resolver.
+//
+// Whatever the configuration, concurrent resolutions of a description share one polaris call,
+// and the converted instances are reused as long as the polaris revision of the service is unchanged.
+type ResolveCacheConfig struct {
+	// TTL is how long resolved instances are served without asking polaris, zero always asks polaris.
+	TTL time.Duration
+}
+
+// cacheEntry holds the instances of a description resolved from polaris.
+type cacheEntry struct {
+	revision  string
+	instances []discovery.Instance
+	states    *instanceStates
+	fetchedAt time.Time
+}
+
+// resolveCall is a polaris resolution shared by concurrent Resolve calls.
+type resolveCall struct {
+	done  chan struct{}
+	entry *cacheEntry
+	err   error
+}
+
+// resolveCache caches the instances of the descriptions resolved from polaris.
+type resolveCache struct {
+	ttl time.Duration
+
+	lock    sync.Mutex
+	entries map[string]*cacheEntry
+	calls   map[string]*resolveCall
+}
+
+func newResolveCache(cfg ResolveCacheConfig) *resolveCache {
+	return &resolveCache{
+		ttl:     cfg.TTL,
+		entries: make(map[string]*cacheEntry),
+		calls:   make(map[string]*resolveCall),
+	}
+}
+
+// get returns the entry of desc, calling fetch with the former entry, nil at first, when it is missing or expired.
+// Concurrent calls for desc wait for the running fetch, they fetch again if it was abandoned by its caller.
+func (c *resolveCache) get(ctx context.Context, desc string,
+	fetch func(ctx context.Context, former *cacheEntry) (*cacheEntry, error)) (*cacheEntry, error) {
+	for {
+		c.lock.Lock()
+		former := c.entries[desc]
+		if former != nil && c.ttl > 0 && time.Since(former.fetchedAt) < c.ttl {
+			c.lock.Unlock()
+			return former, nil
+		}
+		call, running := c.calls[desc]
+		if !running {
+			call = &resolveCall{done: make(chan struct{})}
+			c.calls[desc] = call
+			c.lock.Unlock()
+
+			call.entry, call.err = fetch(ctx, former)
+			c.lock.Lock()
+			delete(c.calls, desc)
+			if call.err == nil {
+				c.entries[desc] = call.entry
+			}
+			c.lock.Unlock()
+			close(call.done)
+			return call.entry, call.err
+		}
+		c.lock.Unlock()
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if isContextError(call.err) && ctx.Err() == nil {
+			continue
+		}
+		return call.entry, call.err
+	}
+}
+
+// isContextError reports whether err comes from a done context.
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/registry"
+	"github.com/cloudwego/kitex/pkg/utils"
+	"github.com/kitex-contrib/registry-polaris/polaristest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveCacheRevision(t *testing.T) {
+	server := polaristest.NewServer()
+	rg := NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI())
+	rs := NewPolarisResolverByAPI(server.ProviderAPI(), server.ConsumerAPI())
+	first := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+	require.Nil(t, rg.Register(first))
+	defer rg.Deregister(first)
+	desc := polarisDefaultNamespace + ":" + serviceName
+
+	former, err := rs.Resolve(context.Background(), desc)
+	require.Nil(t, err)
+	result, err := rs.Resolve(context.Background(), desc)
+	require.Nil(t, err)
+	// the revision is unchanged, the instances are reused.
+	require.Same(t, former.Instances[0], result.Instances[0])
+	require.Equal(t, 2, server.Calls(polaristest.OpGetInstances))
+
+	second := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:7777")}
+	require.Nil(t, rg.Register(second))
+	defer rg.Deregister(second)
+	result, err = rs.Resolve(context.Background(), desc)
+	require.Nil(t, err)
+	require.Len(t, result.Instances, 2)
+	require.NotSame(t, former.Instances[0], result.Instances[0])
+}
+
+func TestResolveCacheTTL(t *testing.T) {
+	server := polaristest.NewServer()
+	rg := NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI())
+	rs := NewPolarisResolverByAPI(server.ProviderAPI(), server.ConsumerAPI(),
+		WithResolveCache(ResolveCacheConfig{TTL: 100 * time.Millisecond}))
+	first := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+	require.Nil(t, rg.Register(first))
+	defer rg.Deregister(first)
+	desc := polarisDefaultNamespace + ":" + serviceName
+
+	_, err := rs.Resolve(context.Background(), desc)
+	require.Nil(t, err)
+	second := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:7777")}
+	require.Nil(t, rg.Register(second))
+	defer rg.Deregister(second)
+	result, err := rs.Resolve(context.Background(), desc)
+	require.Nil(t, err)
+	require.Len(t, result.Instances, 1)
+	require.Equal(t, 1, server.Calls(polaristest.OpGetInstances))
+
+	require.Eventually(t, func() bool {
+		result, err := rs.Resolve(context.Background(), desc)
+		return err == nil && len(result.Instances) == 2
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestResolveSingleflight(t *testing.T) {
+	server := polaristest.NewServer()
+	rg := NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI())
+	info := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+	require.Nil(t, rg.Register(info))
+	defer rg.Deregister(info)
+	consumer := &blockingConsumer{ConsumerAPI: server.ConsumerAPI(), unblock: make(chan struct{})}
+	rs := NewPolarisResolverByAPI(server.ProviderAPI(), consumer)
+	desc := polarisDefaultNamespace + ":" + serviceName
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := rs.Resolve(context.Background(), desc)
+			require.Nil(t, err)
+			require.Len(t, result.Instances, 1)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(consumer.unblock)
+	wg.Wait()
+	require.Equal(t, int32(1), atomic.LoadInt32(&consumer.calls))
+}
+
+func TestResolveSingleflightCancel(t *testing.T) {
+	server := polaristest.NewServer()
+	rg := NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI())
+	info := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+	require.Nil(t, rg.Register(info))
+	defer rg.Deregister(info)
+	consumer := &blockingConsumer{ConsumerAPI: server.ConsumerAPI(), unblock: make(chan struct{})}
+	rs := NewPolarisResolverByAPI(server.ProviderAPI(), consumer)
+	desc := polarisDefaultNamespace + ":" + serviceName
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leaderDone := make(chan error, 1)
+	go func() {
+		_, err := rs.Resolve(ctx, desc)
+		leaderDone <- err
+	}()
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&consumer.calls) == 1
+	}, time.Second, time.Millisecond)
+	followerDone := make(chan error, 1)
+	go func() {
+		_, err := rs.Resolve(context.Background(), desc)
+		followerDone <- err
+	}()
+
+	// the first caller gives up, the other one fetches again.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	require.ErrorIs(t, <-leaderDone, context.Canceled)
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&consumer.calls) == 2
+	}, time.Second, time.Millisecond)
+	close(consumer.unblock)
+	require.Nil(t, <-followerDone)
+}
@@ -0,0 +1,248 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/cloudwego/kitex/pkg/discovery"
+	"github.com/cloudwego/kitex/pkg/registry"
+	"github.com/cloudwego/kitex/pkg/utils"
+	polaris "github.com/kitex-contrib/registry-polaris"
+	"github.com/polarismesh/polaris-go/api"
+	"github.com/polarismesh/polaris-go/pkg/model"
+)
+
+// tagFlag collects repeated -tag key=value flags.
+type tagFlag map[string]string
+
+func (t tagFlag) String() string {
+	return formatTags(t)
+}
+
+func (t tagFlag) Set(value string) error {
+	kv := strings.SplitN(value, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return fmt.Errorf("tag %q is not key=value", value)
+	}
+	t[kv[0]] = kv[1]
+	return nil
+}
+
+// splitDescription checks desc is namespace:service before splitting it.
+func splitDescription(desc string) (string, string, error) {
+	if strings.Count(desc, ":") != 1 || strings.HasPrefix(desc, ":") || strings.HasSuffix(desc, ":") {
+		return "", "", fmt.Errorf("service %q is not namespace:service", desc)
+	}
+	namespace, service := polaris.SplitDescription(desc)
+	return namespace, service, nil
+}
+
+// checkArgs checks the number of positional arguments.
+func checkArgs(args []string, names ...string) error {
+	if len(args) != len(names) {
+		return fmt.Errorf("expect %s, got %d arguments", strings.Join(names, " "), len(args))
+	}
+	return nil
+}
+
+// allInstances returns the instances of desc, healthy or not.
+func allInstances(env *env, desc string) ([]model.Instance, error) {
+	namespace, service, err := splitDescription(desc)
+	if err != nil {
+		return nil, err
+	}
+	req := &api.GetAllInstancesRequest{}
+	req.Namespace = namespace
+	req.Service = service
+	resp, err := env.consumer.GetAllInstances(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.GetInstances(), nil
+}
+
+func listFlags(fs *flag.FlagSet) func(env *env, args []string) error {
+	healthy := fs.Bool("healthy", false, "only list the healthy and not isolated instances")
+	return func(env *env, args []string) error {
+		if err := checkArgs(args, "namespace:service"); err != nil {
+			return err
+		}
+		instances, err := allInstances(env, args[0])
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(env.out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "HOST\tPORT\tPROTOCOL\tWEIGHT\tHEALTHY\tISOLATED\tMETADATA")
+		for _, ins := range instances {
+			if *healthy && (!ins.IsHealthy() || ins.IsIsolated()) {
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%d\t%t\t%t\t%s\n", ins.GetHost(), ins.GetPort(), ins.GetProtocol(),
+				ins.GetWeight(), ins.IsHealthy(), ins.IsIsolated(), formatTags(ins.GetMetadata()))
+		}
+		return w.Flush()
+	}
+}
+
+func registerFlags(fs *flag.FlagSet) func(env *env, args []string) error {
+	network := fs.String("network", "tcp", "network of the instance, registered as its protocol")
+	weight := fs.Int("weight", 0, "weight of the instance, the polaris default when not set")
+	tags := tagFlag{}
+	fs.Var(tags, "tag", "tag of the instance, registered as metadata, can be repeated")
+	return func(env *env, args []string) error {
+		if err := checkArgs(args, "namespace:service", "host:port"); err != nil {
+			return err
+		}
+		namespace, service, err := splitDescription(args[0])
+		if err != nil {
+			return err
+		}
+		info := &registry.Info{
+			ServiceName: service,
+			Addr:        utils.NewNetAddr(*network, args[1]),
+			Weight:      *weight,
+			Tags:        map[string]string{"namespace": namespace},
+		}
+		for k, v := range tags {
+			info.Tags[k] = v
+		}
+		var opts []polaris.RegistryOption
+		if *weight > 0 {
+			opts = append(opts, polaris.WithInfoWeight())
+		}
+		r := polaris.NewPolarisRegistryByAPI(env.provider, env.consumer, opts...)
+		if err := r.Register(info); err != nil {
+			return err
+		}
+		fmt.Fprintf(env.out, "registered %s %s, interrupt to deregister\n", args[0], args[1])
+		<-env.ctx.Done()
+		if err := r.Deregister(info); err != nil {
+			return err
+		}
+		fmt.Fprintf(env.out, "deregistered %s %s\n", args[0], args[1])
+		return nil
+	}
+}
+
+func deregisterFlags(fs *flag.FlagSet) func(env *env, args []string) error {
+	return func(env *env, args []string) error {
+		if err := checkArgs(args, "namespace:service", "host:port"); err != nil {
+			return err
+		}
+		namespace, service, err := splitDescription(args[0])
+		if err != nil {
+			return err
+		}
+		host, port, err := polaris.GetInfoHostAndPort(args[1])
+		if err != nil {
+			return err
+		}
+		req := &api.InstanceDeRegisterRequest{}
+		req.Namespace = namespace
+		req.Service = service
+		req.Host = host
+		req.Port = port
+		if err := env.provider.Deregister(req); err != nil {
+			return err
+		}
+		fmt.Fprintf(env.out, "deregistered %s\n", polaris.GetInstanceKey(namespace, service, host, strconv.Itoa(port)))
+		return nil
+	}
+}
+
+func watchFlags(fs *flag.FlagSet) func(env *env, args []string) error {
+	return func(env *env, args []string) error {
+		if err := checkArgs(args, "namespace:service"); err != nil {
+			return err
+		}
+		if _, _, err := splitDescription(args[0]); err != nil {
+			return err
+		}
+		r := polaris.NewPolarisResolverByAPI(env.provider, env.consumer).(polaris.Subscriber)
+		// the first change adds the instances of the service, the handler runs on a single goroutine.
+		first := true
+		sub, err := r.Subscribe(args[0], func(change discovery.Change) {
+			added := "+"
+			if first {
+				added, first = "=", false
+			}
+			for _, ins := range change.Added {
+				printInstance(env.out, added, ins)
+			}
+			for _, ins := range change.Updated {
+				printInstance(env.out, "~", ins)
+			}
+			for _, ins := range change.Removed {
+				printInstance(env.out, "-", ins)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		<-env.ctx.Done()
+		sub.Unsubscribe()
+		return nil
+	}
+}
+
+func convertFlags(fs *flag.FlagSet) func(env *env, args []string) error {
+	return func(env *env, args []string) error {
+		if err := checkArgs(args, "namespace:service"); err != nil {
+			return err
+		}
+		instances, err := allInstances(env, args[0])
+		if err != nil {
+			return err
+		}
+		for _, ins := range instances {
+			fmt.Fprintf(env.out, "polaris host=%s port=%d protocol=%s weight=%d metadata=%s\n", ins.GetHost(),
+				ins.GetPort(), ins.GetProtocol(), ins.GetWeight(), formatTags(ins.GetMetadata()))
+			kitex := polaris.ChangePolarisInstanceToKitex(ins)
+			// Kitex instances cannot list their tags, those of the conversion are the metadata and the namespace.
+			tags := map[string]string{}
+			for k := range ins.GetMetadata() {
+				tags[k], _ = kitex.Tag(k)
+			}
+			tags["namespace"], _ = kitex.Tag("namespace")
+			fmt.Fprintf(env.out, "  kitex network=%s address=%s weight=%d tags=%s\n", kitex.Address().Network(),
+				kitex.Address().String(), kitex.Weight(), formatTags(tags))
+		}
+		return nil
+	}
+}
+
+// printInstance prints a Kitex instance prefixed by mark.
+func printInstance(out io.Writer, mark string, ins discovery.Instance) {
+	fmt.Fprintf(out, "%s %s %s weight=%d\n", mark, ins.Address().Network(), ins.Address().String(), ins.Weight())
+}
+
+// formatTags formats tags as sorted key=value pairs.
+func formatTags(tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kitex-contrib/registry-polaris/polaristest"
+	"github.com/stretchr/testify/require"
+)
+
+// syncBuffer is a bytes.Buffer written by a running command while the test reads it.
+type syncBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+func newEnv(ctx context.Context, server *polaristest.Server) (*env, *syncBuffer) {
+	out := &syncBuffer{}
+	return &env{ctx: ctx, out: out, provider: server.ProviderAPI(), consumer: server.ConsumerAPI()}, out
+}
+
+func TestCommands(t *testing.T) {
+	server := polaristest.NewServer()
+	ctx, cancel := context.WithCancel(context.Background())
+	registerEnv, registerOut := newEnv(ctx, server)
+	done := make(chan error, 1)
+	go func() {
+		done <- run(registerEnv, []string{"register", "-weight", "50", "-tag", "idc=hz", "default:echo", "127.0.0.1:8888"})
+	}()
+	require.Eventually(t, func() bool {
+		return len(server.Instances("default", "echo")) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	env, out := newEnv(context.Background(), server)
+	require.Nil(t, run(env, []string{"list", "default:echo"}))
+	require.Contains(t, out.String(), "127.0.0.1  8888  tcp       50")
+	require.Contains(t, out.String(), "idc=hz")
+
+	env, out = newEnv(context.Background(), server)
+	require.Nil(t, run(env, []string{"convert", "default:echo"}))
+	require.Contains(t, out.String(), "kitex network=tcp address=127.0.0.1:8888 weight=50 tags=idc=hz,namespace=default")
+
+	cancel()
+	require.Nil(t, <-done)
+	require.Contains(t, registerOut.String(), "deregistered default:echo 127.0.0.1:8888")
+	require.Empty(t, server.Instances("default", "echo"))
+}
+
+// register runs the register command until the returned func is called.
+func register(t *testing.T, server *polaristest.Server, addr string) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	env, _ := newEnv(ctx, server)
+	done := make(chan error, 1)
+	go func() {
+		done <- run(env, []string{"register", "default:echo", addr})
+	}()
+	return func() {
+		cancel()
+		require.Nil(t, <-done)
+	}
+}
+
+func TestWatchCommand(t *testing.T) {
+	server := polaristest.NewServer()
+	// polaris cannot watch a service before its first instance registers.
+	defer register(t, server, "127.0.0.1:7777")()
+	require.Eventually(t, func() bool {
+		return len(server.Instances("default", "echo")) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	env, out := newEnv(ctx, server)
+	done := make(chan error, 1)
+	go func() {
+		done <- run(env, []string{"watch", "default:echo"})
+	}()
+	require.Eventually(t, func() bool {
+		return strings.Contains(out.String(), "= tcp 127.0.0.1:7777")
+	}, time.Second, 10*time.Millisecond)
+
+	deregister := register(t, server, "127.0.0.1:8888")
+	require.Eventually(t, func() bool {
+		return strings.Contains(out.String(), "+ tcp 127.0.0.1:8888")
+	}, time.Second, 10*time.Millisecond)
+	deregister()
+	require.Eventually(t, func() bool {
+		return strings.Contains(out.String(), "- tcp 127.0.0.1:8888")
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+	require.Nil(t, <-done)
+	require.Equal(t, 1, server.Calls(polaristest.OpWatchService))
+}
+
+func TestCommandErrors(t *testing.T) {
+	env, _ := newEnv(context.Background(), polaristest.NewServer())
+	require.NotNil(t, run(env, []string{"unknown"}))
+	require.NotNil(t, run(env, []string{"list", "echo"}))
+	require.NotNil(t, run(env, []string{"deregister", "default:echo"}))
+	require.NotNil(t, run(env, []string{"register", "-tag", "idc", "default:echo", "127.0.0.1:8888"}))
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Command kitex-polaris inspects and manipulates the polaris services of Kitex applications.
+//
+//	kitex-polaris [-config polaris.yaml] <command> [arguments]
+//
+// Services are given as namespace:service, the description format of the polaris resolver.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	polaris "github.com/kitex-contrib/registry-polaris"
+	"github.com/polarismesh/polaris-go/api"
+)
+
+func main() {
+	flags := flag.NewFlagSet("kitex-polaris", flag.ExitOnError)
+	configFile := flags.String("config", "", "polaris configuration file, ./polaris.yaml by default")
+	flags.Usage = func() { usage(flags) }
+	flags.Parse(os.Args[1:])
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	var configFiles []string
+	if *configFile != "" {
+		configFiles = append(configFiles, *configFile)
+	}
+	sdkCtx, err := polaris.GetPolarisConfig(configFiles...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "kitex-polaris: fail to load polaris configuration: %v\n", err)
+		os.Exit(1)
+	}
+	defer sdkCtx.Destroy()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	env := &env{
+		ctx:      ctx,
+		out:      os.Stdout,
+		provider: api.NewProviderAPIByContext(sdkCtx),
+		consumer: api.NewConsumerAPIByContext(sdkCtx),
+	}
+	if err := run(env, flags.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "kitex-polaris: %v\n", err)
+		sdkCtx.Destroy()
+		os.Exit(1)
+	}
+}
+
+// env is what commands run with.
+type env struct {
+	// ctx is done when the command is interrupted.
+	ctx      context.Context
+	out      io.Writer
+	provider api.ProviderAPI
+	consumer api.ConsumerAPI
+}
+
+// command is a subcommand of kitex-polaris.
+type command struct {
+	name  string
+	args  string
+	help  string
+	flags func(fs *flag.FlagSet) func(env *env, args []string) error
+}
+
+var commands = []command{
+	{name: "list", args: "[-healthy] namespace:service", help: "list the instances of a service", flags: listFlags},
+	{name: "register", args: "[-network tcp] [-weight n] [-tag key=value]... namespace:service host:port",
+		help: "register a test instance, heartbeating until interrupted, then deregister it", flags: registerFlags},
+	{name: "deregister", args: "namespace:service host:port", help: "deregister an instance", flags: deregisterFlags},
+	{name: "watch", args: "namespace:service", help: "print the changes of a service until interrupted", flags: watchFlags},
+	{name: "convert", args: "namespace:service",
+		help: "show how ChangePolarisInstanceToKitex converts the instances of a service", flags: convertFlags},
+}
+
+// run runs the command named by args[0].
+func run(env *env, args []string) error {
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+		fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+		fs.SetOutput(env.out)
+		fs.Usage = func() {
+			fmt.Fprintf(env.out, "usage: kitex-polaris %s %s\n", cmd.name, cmd.args)
+			fs.PrintDefaults()
+		}
+		runCmd := cmd.flags(fs)
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		return runCmd(env, fs.Args())
+	}
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+func usage(flags *flag.FlagSet) {
+	out := flags.Output()
+	fmt.Fprintln(out, "usage: kitex-polaris [-config polaris.yaml] <command> [arguments]")
+	fmt.Fprintln(out, "\ncommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-10s %s\n", cmd.name, cmd.help)
+		fmt.Fprintf(out, "  %-10s   kitex-polaris %s %s\n", "", cmd.name, cmd.args)
+	}
+	fmt.Fprintln(out, "\nflags:")
+	flags.PrintDefaults()
+}
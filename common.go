@@ -66,38 +66,92 @@ func ChangePolarisInstanceToKitex(PolarisInstance model.Instance) discovery.Inst
 	if weight <= 0 {
 		weight = defaultWeight
 	}
-	addr := PolarisInstance.GetHost() + ":" + strconv.Itoa(int(PolarisInstance.GetPort()))
+	addr := net.JoinHostPort(PolarisInstance.GetHost(), strconv.Itoa(int(PolarisInstance.GetPort())))
 
-	tags := map[string]string{
-		"namespace": PolarisInstance.GetNamespace(),
-	}
-
-	KitexInstance := discovery.NewInstance(PolarisInstance.GetProtocol(), addr, weight, tags)
+	KitexInstance := discovery.NewInstance(PolarisInstance.GetProtocol(), addr, weight, instanceTags(PolarisInstance))
 	// In KitexInstance , tags can be used as IDC、Cluster、Env 、namespace、and so on.
 	return KitexInstance
 }
 
+// instanceTags returns the Kitex tags of a polaris instance, its metadata along with its namespace.
+func instanceTags(PolarisInstance model.Instance) map[string]string {
+	tags := make(map[string]string, len(PolarisInstance.GetMetadata())+1)
+	for k, v := range PolarisInstance.GetMetadata() {
+		tags[k] = v
+	}
+	tags["namespace"] = PolarisInstance.GetNamespace()
+	return tags
+}
+
+// IPPreference decides which IP family is used when a local address is needed.
+type IPPreference int
+
+const (
+	// PreferIPv4 uses an IPv4 address, or an IPv6 one when there is no IPv4 address.
+	PreferIPv4 IPPreference = iota
+	// PreferIPv6 uses an IPv6 address, or an IPv4 one when there is no IPv6 address.
+	PreferIPv6
+	// IPv4Only only uses IPv4 addresses.
+	IPv4Only
+	// IPv6Only only uses IPv6 addresses.
+	IPv6Only
+)
+
 // GetLocalIPv4Address gets local ipv4 address when info host is empty.
 func GetLocalIPv4Address() (string, error) {
+	return GetLocalIPAddress(IPv4Only)
+}
+
+// GetLocalIPv6Address gets local global unicast ipv6 address when info host is empty.
+func GetLocalIPv6Address() (string, error) {
+	return GetLocalIPAddress(IPv6Only)
+}
+
+// GetLocalIPAddress gets the first non-loopback local address matching pref.
+// Link-local IPv6 addresses are skipped as they are not reachable without a zone.
+func GetLocalIPAddress(pref IPPreference) (string, error) {
 	addr, err := net.InterfaceAddrs()
 	if err != nil {
 		return "", err
 	}
+	return selectIPAddress(addr, pref, func(net.IP) bool { return true })
+}
 
-	for _, addr := range addr {
-		ipNet, isIpNet := addr.(*net.IPNet)
-		if isIpNet && !ipNet.IP.IsLoopback() {
-			ipv4 := ipNet.IP.To4()
-			if ipv4 != nil {
-				return ipv4.String(), nil
-			}
-		}
+// pickIPAddress picks between the candidate ipv4 and ipv6 addresses according to pref.
+func pickIPAddress(ipv4, ipv6 string, pref IPPreference) (string, error) {
+	switch pref {
+	case IPv4Only:
+		ipv6 = ""
+	case IPv6Only:
+		ipv4 = ""
+	}
+	first, second := ipv4, ipv6
+	if pref == PreferIPv6 || pref == IPv6Only {
+		first, second = ipv6, ipv4
+	}
+	if first != "" {
+		return first, nil
 	}
-	return "", fmt.Errorf("not found ipv4 address")
+	if second != "" {
+		return second, nil
+	}
+	switch pref {
+	case IPv4Only:
+		return "", fmt.Errorf("not found ipv4 address")
+	case IPv6Only:
+		return "", fmt.Errorf("not found ipv6 address")
+	}
+	return "", fmt.Errorf("not found ip address")
 }
 
 // GetInfoHostAndPort gets Host and port from info.Addr.
+// An empty or unspecified host, such as "::" or "0.0.0.0", is replaced by the local ipv4 address.
 func GetInfoHostAndPort(Addr string) (string, int, error) {
+	return getInfoHostAndPort(Addr, GetLocalIPv4Address)
+}
+
+// getInfoHostAndPort gets Host and port from info.Addr, localIP is used when the host is empty or unspecified.
+func getInfoHostAndPort(Addr string, localIP func() (string, error)) (string, int, error) {
 	infoHost, port, err := net.SplitHostPort(Addr)
 	if err != nil {
 		return "", 0, err
@@ -105,12 +159,12 @@ func GetInfoHostAndPort(Addr string) (string, int, error) {
 		if port == "" {
 			return infoHost, 0, fmt.Errorf("registry info addr missing port")
 		}
-		if infoHost == "" {
-			ipv4, err := GetLocalIPv4Address()
+		if ip := net.ParseIP(infoHost); infoHost == "" || (ip != nil && ip.IsUnspecified()) {
+			localHost, err := localIP()
 			if err != nil {
-				return "", 0, fmt.Errorf("get local ipv4 error, cause %v", err)
+				return "", 0, fmt.Errorf("get local ip error, cause %v", err)
 			}
-			infoHost = ipv4
+			infoHost = localHost
 		}
 	}
 	infoPort, err := strconv.Atoi(port)
@@ -121,14 +175,13 @@ func GetInfoHostAndPort(Addr string) (string, int, error) {
 }
 
 // GetInstanceKey generates instanceKey  for one instance.
+// host and port are joined with net.JoinHostPort, so IPv6 hosts are bracketed.
 func GetInstanceKey(namespace, serviceName, host, port string) string {
 	var instanceKey strings.Builder
 	instanceKey.WriteString(namespace)
 	instanceKey.WriteString(":")
 	instanceKey.WriteString(serviceName)
 	instanceKey.WriteString(":")
-	instanceKey.WriteString(host)
-	instanceKey.WriteString(":")
-	instanceKey.WriteString(port)
+	instanceKey.WriteString(net.JoinHostPort(host, port))
 	return instanceKey.String()
 }
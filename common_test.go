@@ -0,0 +1,57 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetInstanceKey(t *testing.T) {
+	require.Equal(t, "default:echo:127.0.0.1:8888", GetInstanceKey("default", "echo", "127.0.0.1", "8888"))
+	require.Equal(t, "default:echo:[fd00::1]:8888", GetInstanceKey("default", "echo", "fd00::1", "8888"))
+}
+
+func TestGetInfoHostAndPort(t *testing.T) {
+	localIP := func() (string, error) {
+		return "fd00::2", nil
+	}
+	for addr, host := range map[string]string{
+		"10.0.0.1:8888":  "10.0.0.1",
+		"[fd00::1]:8888": "fd00::1",
+		":8888":          "fd00::2",
+		"[::]:8888":      "fd00::2",
+		"0.0.0.0:8888":   "fd00::2",
+	} {
+		infoHost, infoPort, err := getInfoHostAndPort(addr, localIP)
+		require.Nil(t, err)
+		require.Equal(t, host, infoHost)
+		require.Equal(t, 8888, infoPort)
+	}
+}
+
+func TestPickIPAddress(t *testing.T) {
+	addr, _ := pickIPAddress("10.0.0.1", "fd00::1", PreferIPv4)
+	require.Equal(t, "10.0.0.1", addr)
+	addr, _ = pickIPAddress("10.0.0.1", "fd00::1", PreferIPv6)
+	require.Equal(t, "fd00::1", addr)
+	addr, _ = pickIPAddress("", "fd00::1", PreferIPv4)
+	require.Equal(t, "fd00::1", addr)
+	_, err := pickIPAddress("", "fd00::1", IPv4Only)
+	require.NotNil(t, err)
+}
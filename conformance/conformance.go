@@ -0,0 +1,289 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package conformance checks that implementations of the Kitex Registry and
+// Resolver interfaces backed by polaris, like decorators wrapping the ones of
+// this module, keep their semantics.
+package conformance
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/discovery"
+	"github.com/cloudwego/kitex/pkg/registry"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"github.com/cloudwego/kitex/pkg/utils"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// propagationTimeout bounds how long a change takes to be visible through the resolver.
+	propagationTimeout = 10 * time.Second
+	pollInterval       = 10 * time.Millisecond
+	// watchSetupDelay leaves time for a watcher to subscribe before the watched change is made.
+	watchSetupDelay = 100 * time.Millisecond
+	namespace       = "default"
+)
+
+// Resolver is a discovery.Resolver which can also watch the changes of a description,
+// like the resolvers of this module.
+type Resolver interface {
+	discovery.Resolver
+
+	Watcher(ctx context.Context, desc string) (discovery.Change, error)
+}
+
+// Factory creates a registry and a resolver backed by the same polaris, it is called once per check.
+// The registry is expected to register registry.Info.Weight, as with polaris.WithInfoWeight.
+type Factory func(t *testing.T) (registry.Registry, Resolver)
+
+// RunRegistryConformance runs the conformance checks against the implementations created by factory.
+// Every check uses its own service, so the implementations may share a long-lived polaris cluster.
+func RunRegistryConformance(t *testing.T, factory Factory) {
+	checks := []struct {
+		name string
+		run  func(t *testing.T, rg registry.Registry, rs Resolver)
+	}{
+		{"RegisterIdempotency", testRegisterIdempotency},
+		{"DeregisterIdempotency", testDeregisterIdempotency},
+		{"TagRoundTrip", testTagRoundTrip},
+		{"Weight", testWeight},
+		{"WatchOrdering", testWatchOrdering},
+		{"Shutdown", testShutdown},
+	}
+	for _, check := range checks {
+		check := check
+		t.Run(check.name, func(t *testing.T) {
+			rg, rs := factory(t)
+			check.run(t, rg, rs)
+		})
+	}
+}
+
+// testRegisterIdempotency registers the same server twice, it must show up once.
+func testRegisterIdempotency(t *testing.T, rg registry.Registry, rs Resolver) {
+	info := newInfo(t, "127.0.0.1:18001")
+	require.NoError(t, rg.Register(info))
+	require.NoError(t, rg.Register(info), "registering twice must succeed")
+	defer rg.Deregister(info)
+
+	desc := target(rs, info)
+	waitInstances(t, rs, desc, func(instances []discovery.Instance) bool {
+		return count(instances, info.Addr.String()) == 1
+	}, "%s must be resolved exactly once", info.Addr)
+
+	require.NoError(t, rg.Deregister(info))
+	waitInstances(t, rs, desc, func(instances []discovery.Instance) bool {
+		return count(instances, info.Addr.String()) == 0
+	}, "%s must disappear after one deregistration", info.Addr)
+}
+
+// testDeregisterIdempotency deregisters a server twice, the second call may fail but must not
+// break later registrations.
+func testDeregisterIdempotency(t *testing.T, rg registry.Registry, rs Resolver) {
+	info := newInfo(t, "127.0.0.1:18002")
+	desc := target(rs, info)
+	require.NoError(t, rg.Register(info))
+	waitInstances(t, rs, desc, func(instances []discovery.Instance) bool {
+		return count(instances, info.Addr.String()) == 1
+	}, "%s must be resolved after registration", info.Addr)
+
+	require.NoError(t, rg.Deregister(info))
+	require.NotPanics(t, func() { _ = rg.Deregister(info) }, "deregistering twice must not panic")
+	waitInstances(t, rs, desc, func(instances []discovery.Instance) bool {
+		return count(instances, info.Addr.String()) == 0
+	}, "%s must stay deregistered", info.Addr)
+
+	require.NoError(t, rg.Register(info), "registering again after deregistration must succeed")
+	defer rg.Deregister(info)
+	waitInstances(t, rs, desc, func(instances []discovery.Instance) bool {
+		return count(instances, info.Addr.String()) == 1
+	}, "%s must be resolved after registering again", info.Addr)
+}
+
+// testTagRoundTrip checks that registered tags are resolved back as instance tags.
+func testTagRoundTrip(t *testing.T, rg registry.Registry, rs Resolver) {
+	info := newInfo(t, "127.0.0.1:18003")
+	info.Tags["env"] = "conformance"
+	info.Tags["cluster"] = "c1"
+	require.NoError(t, rg.Register(info))
+	defer rg.Deregister(info)
+
+	ins := waitInstance(t, rs, target(rs, info), info.Addr.String())
+	for k, v := range info.Tags {
+		got, ok := ins.Tag(k)
+		require.True(t, ok, "tag %s is missing", k)
+		require.Equal(t, v, got, "tag %s", k)
+	}
+}
+
+// testWeight checks that the registered weight is resolved back, and that a default one is used without weight.
+func testWeight(t *testing.T, rg registry.Registry, rs Resolver) {
+	weighted := newInfo(t, "127.0.0.1:18004")
+	weighted.Weight = 37
+	unweighted := newInfo(t, "127.0.0.1:18005")
+	require.NoError(t, rg.Register(weighted))
+	defer rg.Deregister(weighted)
+	require.NoError(t, rg.Register(unweighted))
+	defer rg.Deregister(unweighted)
+
+	desc := target(rs, weighted)
+	require.Equal(t, 37, waitInstance(t, rs, desc, weighted.Addr.String()).Weight())
+	require.Greater(t, waitInstance(t, rs, desc, unweighted.Addr.String()).Weight(), 0)
+}
+
+// testWatchOrdering checks that every change is reported by the watcher started before it.
+func testWatchOrdering(t *testing.T, rg registry.Registry, rs Resolver) {
+	first := newInfo(t, "127.0.0.1:18006")
+	second := newInfo(t, "127.0.0.1:18007")
+	desc := target(rs, first)
+	require.NoError(t, rg.Register(first))
+	defer rg.Deregister(first)
+	waitInstance(t, rs, desc, first.Addr.String())
+
+	change := watch(t, rs, desc, func() { require.NoError(t, rg.Register(second)) })
+	defer rg.Deregister(second)
+	require.Equal(t, 1, count(change.Added, second.Addr.String()), "registration must be reported as added")
+	require.Equal(t, 1, count(change.Result.Instances, first.Addr.String()), "result must hold the instances before the change")
+
+	second.Weight = 42
+	change = watch(t, rs, desc, func() { require.NoError(t, rg.Register(second)) })
+	require.Equal(t, 1, count(change.Updated, second.Addr.String()), "registering again must be reported as updated")
+
+	change = watch(t, rs, desc, func() { require.NoError(t, rg.Deregister(first)) })
+	require.Equal(t, 1, count(change.Removed, first.Addr.String()), "deregistration must be reported as removed")
+}
+
+// testShutdown checks that deregistered servers are not resolved anymore and that watchers stop with their context.
+func testShutdown(t *testing.T, rg registry.Registry, rs Resolver) {
+	infos := []*registry.Info{newInfo(t, "127.0.0.1:18008"), newInfo(t, "127.0.0.1:18009")}
+	desc := target(rs, infos[0])
+	for _, info := range infos {
+		require.NoError(t, rg.Register(info))
+	}
+	waitInstances(t, rs, desc, func(instances []discovery.Instance) bool {
+		return len(instances) == len(infos)
+	}, "every server must be resolved")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := rs.Watcher(ctx, desc)
+		done <- err
+	}()
+	time.Sleep(watchSetupDelay)
+	cancel()
+	select {
+	case err := <-done:
+		require.NoError(t, err, "a cancelled watcher must return without error")
+	case <-time.After(propagationTimeout):
+		t.Fatal("watcher did not return after its context was cancelled")
+	}
+
+	for _, info := range infos {
+		require.NoError(t, rg.Deregister(info))
+	}
+	waitInstances(t, rs, desc, func(instances []discovery.Instance) bool {
+		return len(instances) == 0
+	}, "no server must be resolved after shutdown")
+}
+
+var invalidNameChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// newInfo returns a server of a service dedicated to the running check.
+func newInfo(t *testing.T, addr string) *registry.Info {
+	name := invalidNameChars.ReplaceAllString(strings.ToLower(t.Name()), "-")
+	return &registry.Info{
+		ServiceName: fmt.Sprintf("conformance-%s-%d", name, startTime),
+		Addr:        utils.NewNetAddr("tcp", addr),
+		Tags:        map[string]string{"namespace": namespace},
+	}
+}
+
+// startTime separates the services of successive runs against the same polaris cluster.
+var startTime = time.Now().Unix()
+
+func target(rs Resolver, info *registry.Info) string {
+	return rs.Target(context.Background(), rpcinfo.NewEndpointInfo(info.ServiceName, "", nil, info.Tags))
+}
+
+// resolve returns the resolved instances of desc, resolution errors count as no instance.
+func resolve(rs Resolver, desc string) []discovery.Instance {
+	result, err := rs.Resolve(context.Background(), desc)
+	if err != nil {
+		return nil
+	}
+	return result.Instances
+}
+
+func waitInstances(t *testing.T, rs Resolver, desc string, cond func([]discovery.Instance) bool,
+	msgAndArgs ...interface{}) {
+	t.Helper()
+	require.Eventually(t, func() bool { return cond(resolve(rs, desc)) }, propagationTimeout, pollInterval, msgAndArgs...)
+}
+
+// waitInstance waits until addr is resolved and returns its instance.
+func waitInstance(t *testing.T, rs Resolver, desc, addr string) discovery.Instance {
+	t.Helper()
+	var found discovery.Instance
+	waitInstances(t, rs, desc, func(instances []discovery.Instance) bool {
+		for _, ins := range instances {
+			if ins.Address().String() == addr {
+				found = ins
+				return true
+			}
+		}
+		return false
+	}, "%s must be resolved", addr)
+	return found
+}
+
+// watch starts a watcher on desc, makes the change and returns what the watcher reported.
+func watch(t *testing.T, rs Resolver, desc string, change func()) discovery.Change {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), propagationTimeout)
+	defer cancel()
+	type watched struct {
+		change discovery.Change
+		err    error
+	}
+	done := make(chan watched, 1)
+	go func() {
+		c, err := rs.Watcher(ctx, desc)
+		done <- watched{c, err}
+	}()
+	time.Sleep(watchSetupDelay)
+	change()
+	w := <-done
+	require.NoError(t, w.err)
+	require.NoError(t, ctx.Err(), "watcher did not report the change")
+	return w.change
+}
+
+func count(instances []discovery.Instance, addr string) int {
+	n := 0
+	for _, ins := range instances {
+		if ins.Address().String() == addr {
+			n++
+		}
+	}
+	return n
+}
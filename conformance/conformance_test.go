@@ -0,0 +1,44 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package conformance
+
+import (
+	"testing"
+
+	"github.com/cloudwego/kitex/pkg/registry"
+	polaris "github.com/kitex-contrib/registry-polaris"
+	"github.com/kitex-contrib/registry-polaris/polaristest"
+)
+
+func TestPolarisConformance(t *testing.T) {
+	RunRegistryConformance(t, func(t *testing.T) (registry.Registry, Resolver) {
+		server := polaristest.NewServer()
+		return polaris.NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI(), polaris.WithInfoWeight()),
+			polaris.NewPolarisResolverByAPI(server.ProviderAPI(), server.ConsumerAPI())
+	})
+}
+
+func TestMultiClusterConformance(t *testing.T) {
+	RunRegistryConformance(t, func(t *testing.T) (registry.Registry, Resolver) {
+		old, current := polaristest.NewServer(), polaristest.NewServer()
+		rg := polaris.NewMultiClusterRegistry([]polaris.RegistryCluster{
+			{Name: "old", Registry: polaris.NewPolarisRegistryByAPI(old.ProviderAPI(), old.ConsumerAPI(), polaris.WithInfoWeight())},
+			{Name: "new", Registry: polaris.NewPolarisRegistryByAPI(current.ProviderAPI(), current.ConsumerAPI(), polaris.WithInfoWeight())},
+		})
+		return rg, polaris.NewPolarisResolverByAPI(current.ProviderAPI(), current.ConsumerAPI())
+	})
+}
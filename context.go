@@ -0,0 +1,123 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/registry"
+)
+
+// minRequestTimeout is the timeout of the requests made under a context about to expire.
+const minRequestTimeout = time.Millisecond
+
+// requestTimeout returns the timeout of a polaris request made under ctx: def, or the time left
+// before the deadline of ctx when it is closer. A nil def stands for the timeout configured in polaris-go.
+func requestTimeout(ctx context.Context, def *time.Duration) *time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return def
+	}
+	left := time.Until(deadline)
+	if left < minRequestTimeout {
+		left = minRequestTimeout
+	}
+	if def != nil && *def < left {
+		return def
+	}
+	return &left
+}
+
+// callContext runs call and returns its error, or the error of ctx as soon as ctx is done.
+// polaris-go calls cannot be interrupted, an abandoned call goes on in the background until its timeout,
+// so the variables it sets must only be read when callContext returns nil.
+func callContext(ctx context.Context, call func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if ctx.Done() == nil {
+		return call()
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- call()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// callContextUndo is callContext, undo is called once a call abandoned as ctx is done succeeds.
+func callContextUndo(ctx context.Context, call func() error, undo func()) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if ctx.Done() == nil {
+		return call()
+	}
+	var lock sync.Mutex
+	abandoned := false
+	done := make(chan error, 1)
+	go func() {
+		err := call()
+		lock.Lock()
+		if !abandoned {
+			done <- err
+			lock.Unlock()
+			return
+		}
+		lock.Unlock()
+		if err == nil {
+			undo()
+		}
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		lock.Lock()
+		defer lock.Unlock()
+		select {
+		case err := <-done:
+			return err
+		default:
+			abandoned = true
+			return ctx.Err()
+		}
+	}
+}
+
+// registerContext registers info to r within ctx when r is a ContextRegistry.
+func registerContext(ctx context.Context, r registry.Registry, info *registry.Info) error {
+	if cr, ok := r.(ContextRegistry); ok {
+		return cr.RegisterContext(ctx, info)
+	}
+	return r.Register(info)
+}
+
+// deregisterContext deregisters info from r within ctx when r is a ContextRegistry.
+func deregisterContext(ctx context.Context, r registry.Registry, info *registry.Info) error {
+	if cr, ok := r.(ContextRegistry); ok {
+		return cr.DeregisterContext(ctx, info)
+	}
+	return r.Deregister(info)
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/registry"
+	"github.com/cloudwego/kitex/pkg/utils"
+	"github.com/kitex-contrib/registry-polaris/polaristest"
+	"github.com/polarismesh/polaris-go/api"
+	"github.com/polarismesh/polaris-go/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingProvider blocks the registrations and heartbeats until unblock is closed.
+type blockingProvider struct {
+	api.ProviderAPI
+	blocked chan time.Duration
+	unblock chan struct{}
+}
+
+func (p *blockingProvider) Register(req *api.InstanceRegisterRequest) (*model.InstanceRegisterResponse, error) {
+	p.blocked <- *req.Timeout
+	<-p.unblock
+	return p.ProviderAPI.Register(req)
+}
+
+func (p *blockingProvider) Heartbeat(req *api.InstanceHeartbeatRequest) error {
+	p.blocked <- *req.Timeout
+	<-p.unblock
+	return p.ProviderAPI.Heartbeat(req)
+}
+
+// blockingConsumer counts the GetInstances calls and blocks them until unblock is closed.
+type blockingConsumer struct {
+	api.ConsumerAPI
+	calls   int32
+	unblock chan struct{}
+}
+
+func (c *blockingConsumer) GetInstances(req *api.GetInstancesRequest) (*model.InstancesResponse, error) {
+	atomic.AddInt32(&c.calls, 1)
+	<-c.unblock
+	return c.ConsumerAPI.GetInstances(req)
+}
+
+func TestRequestTimeout(t *testing.T) {
+	def := time.Second
+	require.Equal(t, &def, requestTimeout(context.Background(), &def))
+	require.Nil(t, requestTimeout(context.Background(), nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	require.Equal(t, &def, requestTimeout(ctx, &def))
+	require.InDelta(t, time.Hour, *requestTimeout(ctx, nil), float64(time.Minute))
+
+	ctx, cancel = context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	require.Equal(t, minRequestTimeout, *requestTimeout(ctx, &def))
+}
+
+func TestRegisterContext(t *testing.T) {
+	server := polaristest.NewServer()
+	provider := &blockingProvider{
+		ProviderAPI: server.ProviderAPI(),
+		blocked:     make(chan time.Duration, 1),
+		unblock:     make(chan struct{}),
+	}
+	rg := NewPolarisRegistryByAPI(provider, server.ConsumerAPI())
+	info := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := rg.(ContextRegistry).RegisterContext(ctx, info)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), time.Second)
+	// the polaris timeout is bounded by the deadline.
+	require.LessOrEqual(t, <-provider.blocked, 100*time.Millisecond)
+
+	// the abandoned registration succeeds, the instance is deregistered again.
+	close(provider.unblock)
+	require.Eventually(t, func() bool {
+		return server.Calls(polaristest.OpDeregister) == 1
+	}, time.Second, time.Millisecond)
+	require.Equal(t, 1, server.Calls(polaristest.OpRegister))
+	require.Empty(t, server.Instances(polarisDefaultNamespace, serviceName))
+}
+
+func TestCallContextUndo(t *testing.T) {
+	undone := make(chan struct{}, 1)
+	undo := func() { undone <- struct{}{} }
+	require.Nil(t, callContextUndo(context.Background(), func() error { return nil }, undo))
+
+	// abandoned failed calls are not undone.
+	unblock := make(chan struct{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, callContextUndo(ctx, func() error {
+		<-unblock
+		return context.Canceled
+	}, undo), context.DeadlineExceeded)
+	close(unblock)
+	select {
+	case <-undone:
+		require.FailNow(t, "failed call undone")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestHeartbeatContext(t *testing.T) {
+	formerHeartbeatTime := heartbeatTime
+	heartbeatTime = 10 * time.Millisecond
+	defer func() { heartbeatTime = formerHeartbeatTime }()
+
+	server := polaristest.NewServer()
+	provider := &blockingProvider{
+		ProviderAPI: server.ProviderAPI(),
+		blocked:     make(chan time.Duration, 1),
+		unblock:     make(chan struct{}),
+	}
+	events := make(chan RegistryEvent, 4)
+	rg := NewPolarisRegistryByAPI(provider, server.ConsumerAPI(),
+		WithRegistryObserver(RegistryObserverFunc(func(event RegistryEvent) { events <- event })))
+	info := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+
+	go func() {
+		// lets the registration through.
+		require.Equal(t, registerTimeout, <-provider.blocked)
+		provider.unblock <- struct{}{}
+	}()
+	require.Nil(t, rg.Register(info))
+	require.Equal(t, EventRegistered, (<-events).Type)
+
+	// the heartbeat hangs, deregistration stops it at once.
+	require.Equal(t, heartbeatTimeout, <-provider.blocked)
+	require.Nil(t, rg.Deregister(info))
+	require.Equal(t, EventDeregistered, (<-events).Type)
+	close(provider.unblock)
+	select {
+	case event := <-events:
+		require.FailNow(t, "unexpected event", "%v", event.Type)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestResolveContext(t *testing.T) {
+	server := polaristest.NewServer()
+	consumer := &blockingConsumer{ConsumerAPI: server.ConsumerAPI(), unblock: make(chan struct{})}
+	defer close(consumer.unblock)
+	desc := polarisDefaultNamespace + ":" + serviceName
+	rs := NewPolarisResolverByAPI(server.ProviderAPI(), consumer, WithStaticFallback(StaticFallbackConfig{
+		Instances: map[string][]StaticInstance{desc: {{Address: "127.0.0.1:6666"}}},
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := rs.Resolve(ctx, desc)
+	// the caller gave up, the static instances are not used.
+	require.ErrorIs(t, err, context.Canceled)
+	require.Less(t, time.Since(start), time.Second)
+}
@@ -0,0 +1,320 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/discovery"
+	"github.com/cloudwego/kitex/pkg/registry"
+	"github.com/polarismesh/polaris-go/api"
+)
+
+// DebugHandler serves the state of registries and resolvers as JSON, it is meant to be mounted
+// on an admin server, like mux.Handle("/debug/polaris", handler).
+type DebugHandler struct {
+	lock       sync.RWMutex
+	registries []debugTarget
+	resolvers  []debugTarget
+}
+
+// debugTarget is a registry or a resolver added to a DebugHandler.
+type debugTarget struct {
+	name   string
+	target interface{}
+}
+
+// debugStater is implemented by the registries and resolvers of this package.
+type debugStater interface {
+	debugState() interface{}
+}
+
+// NewDebugHandler creates an empty DebugHandler.
+func NewDebugHandler() *DebugHandler {
+	return &DebugHandler{}
+}
+
+// AddRegistry adds r to the handler under name, only the type of registries of other packages is shown.
+func (h *DebugHandler) AddRegistry(name string, r registry.Registry) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.registries = append(h.registries, debugTarget{name: name, target: r})
+}
+
+// AddResolver adds r to the handler under name, only the type of resolvers of other packages is shown.
+func (h *DebugHandler) AddResolver(name string, r discovery.Resolver) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.resolvers = append(h.resolvers, debugTarget{name: name, target: r})
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (h *DebugHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	h.lock.RLock()
+	state := struct {
+		Registries []namedDebugState `json:"registries"`
+		Resolvers  []namedDebugState `json:"resolvers"`
+	}{
+		Registries: debugStates(h.registries),
+		Resolvers:  debugStates(h.resolvers),
+	}
+	h.lock.RUnlock()
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// namedDebugState is the state of a registry or a resolver.
+type namedDebugState struct {
+	Name  string      `json:"name"`
+	Type  string      `json:"type"`
+	State interface{} `json:"state,omitempty"`
+}
+
+func debugStates(targets []debugTarget) []namedDebugState {
+	states := make([]namedDebugState, 0, len(targets))
+	for _, t := range targets {
+		states = append(states, newNamedDebugState(t.name, t.target))
+	}
+	return states
+}
+
+// newNamedDebugState returns the state of target, only its type when it is not of this package.
+func newNamedDebugState(name string, target interface{}) namedDebugState {
+	state := namedDebugState{Name: name, Type: fmt.Sprintf("%T", target)}
+	if stater, ok := target.(debugStater); ok {
+		state.State = stater.debugState()
+	}
+	return state
+}
+
+// sdkDebugState is the connection state of a polaris SDKContext.
+type sdkDebugState struct {
+	Addresses      []string `json:"addresses"`
+	ConnectTimeout string   `json:"connect_timeout"`
+	Destroyed      bool     `json:"destroyed"`
+}
+
+// newSDKDebugState returns the connection state of the SDKContext of owner, nil when it has none.
+func newSDKDebugState(owner api.SDKOwner) *sdkDebugState {
+	sdkCtx := owner.SDKContext()
+	if sdkCtx == nil {
+		return nil
+	}
+	connector := sdkCtx.GetConfig().GetGlobal().GetServerConnector()
+	return &sdkDebugState{
+		Addresses:      connector.GetAddresses(),
+		ConnectTimeout: connector.GetConnectTimeout().String(),
+		Destroyed:      sdkCtx.IsDestroyed(),
+	}
+}
+
+// errorString returns the message of err, empty when err is nil.
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// optionalTime returns nil for the zero time, so that it is omitted.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+type registryDebugState struct {
+	SDK       *sdkDebugState       `json:"sdk,omitempty"`
+	Instances []instanceDebugState `json:"instances"`
+}
+
+type instanceDebugState struct {
+	Key            string            `json:"key"`
+	Namespace      string            `json:"namespace"`
+	Service        string            `json:"service"`
+	Host           string            `json:"host"`
+	Port           int               `json:"port"`
+	Weight         *int              `json:"weight,omitempty"`
+	Metadata       map[string]string `json:"metadata,omitempty"`
+	Registered     bool              `json:"registered"`
+	LastHeartbeat  *time.Time        `json:"last_heartbeat,omitempty"`
+	HeartbeatError string            `json:"heartbeat_error,omitempty"`
+}
+
+func (svr *polarisRegistry) debugState() interface{} {
+	state := registryDebugState{SDK: newSDKDebugState(svr.provider)}
+	svr.lock.RLock()
+	state.Instances = make([]instanceDebugState, 0, len(svr.registryIns))
+	for key, ins := range svr.registryIns {
+		req := ins.request
+		state.Instances = append(state.Instances, instanceDebugState{
+			Key:            key,
+			Namespace:      req.Namespace,
+			Service:        req.Service,
+			Host:           req.Host,
+			Port:           req.Port,
+			Weight:         req.Weight,
+			Metadata:       req.Metadata,
+			Registered:     ins.registered,
+			LastHeartbeat:  optionalTime(ins.lastHeartbeat),
+			HeartbeatError: errorString(ins.heartbeatErr),
+		})
+	}
+	svr.lock.RUnlock()
+	sort.Slice(state.Instances, func(i, j int) bool {
+		return state.Instances[i].Key < state.Instances[j].Key
+	})
+	return state
+}
+
+type resolverDebugState struct {
+	SDK        *sdkDebugState           `json:"sdk,omitempty"`
+	Watched    []watchDebugState        `json:"watched"`
+	Subscribed []subscriptionDebugState `json:"subscribed"`
+	Resolved   []resolveDebugState      `json:"resolved"`
+}
+
+type watchDebugState struct {
+	Desc     string `json:"desc"`
+	Watchers int    `json:"watchers"`
+}
+
+type subscriptionDebugState struct {
+	Desc          string `json:"desc"`
+	Subscriptions int    `json:"subscriptions"`
+	// Watcher tells whether the changes are queued for Watcher.
+	Watcher bool `json:"watcher"`
+}
+
+type resolveDebugState struct {
+	Desc       string               `json:"desc"`
+	ResolvedAt time.Time            `json:"resolved_at"`
+	Error      string               `json:"error,omitempty"`
+	Instances  []endpointDebugState `json:"instances"`
+}
+
+type endpointDebugState struct {
+	Network string `json:"network"`
+	Address string `json:"address"`
+	Weight  int    `json:"weight"`
+}
+
+func (polaris *polarisResolver) debugState() interface{} {
+	state := resolverDebugState{SDK: newSDKDebugState(polaris.consumer)}
+	polaris.lock.Lock()
+	state.Watched = make([]watchDebugState, 0, len(polaris.watchers))
+	for desc, count := range polaris.watchers {
+		state.Watched = append(state.Watched, watchDebugState{Desc: desc, Watchers: count})
+	}
+	state.Subscribed = make([]subscriptionDebugState, 0, len(polaris.subscriptions))
+	for desc, w := range polaris.subscriptions {
+		_, watcher := polaris.watcherQueues[desc]
+		subscriptions := w.refs
+		if watcher {
+			subscriptions--
+		}
+		state.Subscribed = append(state.Subscribed, subscriptionDebugState{
+			Desc:          desc,
+			Subscriptions: subscriptions,
+			Watcher:       watcher,
+		})
+	}
+	state.Resolved = make([]resolveDebugState, 0, len(polaris.resolved))
+	for desc, resolved := range polaris.resolved {
+		instances := make([]endpointDebugState, 0, len(resolved.instances))
+		for _, ins := range resolved.instances {
+			instances = append(instances, endpointDebugState{
+				Network: ins.Address().Network(),
+				Address: ins.Address().String(),
+				Weight:  ins.Weight(),
+			})
+		}
+		state.Resolved = append(state.Resolved, resolveDebugState{
+			Desc:       desc,
+			ResolvedAt: resolved.at,
+			Error:      errorString(resolved.err),
+			Instances:  instances,
+		})
+	}
+	polaris.lock.Unlock()
+	sort.Slice(state.Watched, func(i, j int) bool { return state.Watched[i].Desc < state.Watched[j].Desc })
+	sort.Slice(state.Subscribed, func(i, j int) bool { return state.Subscribed[i].Desc < state.Subscribed[j].Desc })
+	sort.Slice(state.Resolved, func(i, j int) bool { return state.Resolved[i].Desc < state.Resolved[j].Desc })
+	return state
+}
+
+type clusterDebugState struct {
+	namedDebugState
+	Registered        int        `json:"registered"`
+	HeartbeatFailures int        `json:"heartbeat_failures"`
+	LastError         string     `json:"last_error,omitempty"`
+	LastErrorAt       *time.Time `json:"last_error_at,omitempty"`
+}
+
+func (m *multiClusterRegistry) debugState() interface{} {
+	status := m.Status()
+	clusters := make([]clusterDebugState, 0, len(m.clusters))
+	for i, cluster := range m.clusters {
+		clusters = append(clusters, clusterDebugState{
+			namedDebugState:   newNamedDebugState(cluster.Name, cluster.Registry),
+			Registered:        status[i].Registered,
+			HeartbeatFailures: status[i].HeartbeatFailures,
+			LastError:         errorString(status[i].LastError),
+			LastErrorAt:       optionalTime(status[i].LastErrorAt),
+		})
+	}
+	return map[string]interface{}{"clusters": clusters}
+}
+
+func (f *federatedResolver) debugState() interface{} {
+	clusters := make([]namedDebugState, 0, len(f.clusters))
+	for _, cluster := range f.clusters {
+		clusters = append(clusters, newNamedDebugState(cluster.Name, cluster.Resolver))
+	}
+	return map[string]interface{}{"clusters": clusters}
+}
+
+func (m *migrationRegistry) debugState() interface{} {
+	return map[string]interface{}{
+		"polaris": newNamedDebugState("polaris", m.polaris),
+		"legacy":  newNamedDebugState("legacy", m.legacy),
+	}
+}
+
+func (m *migrationResolver) debugState() interface{} {
+	return map[string]interface{}{
+		"polaris": newNamedDebugState("polaris", m.polaris),
+		"legacy":  newNamedDebugState(m.legacy.Name(), m.legacy),
+	}
+}
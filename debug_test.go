@@ -0,0 +1,133 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/discovery"
+	"github.com/cloudwego/kitex/pkg/registry"
+	"github.com/cloudwego/kitex/pkg/utils"
+	"github.com/kitex-contrib/registry-polaris/polaristest"
+	"github.com/polarismesh/polaris-go/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebugHandler(t *testing.T) {
+	formerHeartbeatTime := heartbeatTime
+	heartbeatTime = 10 * time.Millisecond
+	defer func() { heartbeatTime = formerHeartbeatTime }()
+
+	server := polaristest.NewServer()
+	rg := NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI())
+	rs := NewPolarisResolverByAPI(server.ProviderAPI(), server.ConsumerAPI())
+	handler := NewDebugHandler()
+	handler.AddRegistry("server", rg)
+	handler.AddResolver("client", rs)
+
+	info := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+	require.Nil(t, rg.Register(info))
+	defer rg.Deregister(info)
+	server.InjectError(polaristest.OpHeartbeat, model.NewSDKError(model.ErrCodeNetworkError, nil, "network"), 1)
+	_, err := rs.Resolve(context.Background(), polarisDefaultNamespace+":"+serviceName)
+	require.Nil(t, err)
+	sub, err := rs.(Subscriber).Subscribe(polarisDefaultNamespace+":"+serviceName, func(discovery.Change) {})
+	require.Nil(t, err)
+	defer sub.Unsubscribe()
+
+	type debugState struct {
+		Registries []struct {
+			Name  string
+			State registryDebugState
+		}
+		Resolvers []struct {
+			Name  string
+			State resolverDebugState
+		}
+	}
+	var state debugState
+	require.Eventually(t, func() bool {
+		state = debugState{}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/polaris", nil))
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &state))
+		ins := state.Registries[0].State.Instances[0]
+		return ins.LastHeartbeat != nil && ins.HeartbeatError == ""
+	}, time.Second, 10*time.Millisecond)
+
+	ins := state.Registries[0].State.Instances[0]
+	require.Equal(t, "server", state.Registries[0].Name)
+	require.Equal(t, serviceName, ins.Service)
+	require.Equal(t, 6666, ins.Port)
+	require.True(t, ins.Registered)
+	resolved := state.Resolvers[0].State.Resolved
+	require.Len(t, resolved, 1)
+	require.Equal(t, polarisDefaultNamespace+":"+serviceName, resolved[0].Desc)
+	require.Equal(t, "127.0.0.1:6666", resolved[0].Instances[0].Address)
+	require.Equal(t, []subscriptionDebugState{{Desc: polarisDefaultNamespace + ":" + serviceName, Subscriptions: 1}},
+		state.Resolvers[0].State.Subscribed)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/debug/polaris", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
+
+func TestDebugHandlerMultiCluster(t *testing.T) {
+	formerHeartbeatTime := heartbeatTime
+	heartbeatTime = 10 * time.Millisecond
+	defer func() { heartbeatTime = formerHeartbeatTime }()
+
+	old, current := polaristest.NewServer(), polaristest.NewServer()
+	rg := NewMultiClusterRegistry([]RegistryCluster{
+		{Name: "old", Registry: NewPolarisRegistryByAPI(old.ProviderAPI(), old.ConsumerAPI())},
+		{Name: "new", Registry: NewPolarisRegistryByAPI(current.ProviderAPI(), current.ConsumerAPI())},
+	})
+	handler := NewDebugHandler()
+	handler.AddRegistry("server", rg)
+
+	info := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+	require.Nil(t, rg.Register(info))
+	defer rg.Deregister(info)
+	old.InjectError(polaristest.OpHeartbeat, model.NewSDKError(model.ErrCodeNetworkError, nil, "network"), 2)
+
+	var state struct {
+		Registries []struct {
+			State struct {
+				Clusters []clusterDebugState
+			}
+		}
+	}
+	require.Eventually(t, func() bool {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/polaris", nil))
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &state))
+		return state.Registries[0].State.Clusters[0].HeartbeatFailures == 2
+	}, time.Second, 10*time.Millisecond)
+
+	clusters := state.Registries[0].State.Clusters
+	require.Equal(t, "old", clusters[0].Name)
+	require.Equal(t, 1, clusters[0].Registered)
+	require.Equal(t, "new", clusters[1].Name)
+	require.Equal(t, 0, clusters[1].HeartbeatFailures)
+}
@@ -0,0 +1,238 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/discovery"
+	"github.com/polarismesh/polaris-go/pkg/model"
+)
+
+// instanceState is the identity and the state of the polaris instance a Kitex instance is converted from.
+type instanceState struct {
+	id       string
+	revision string
+	healthy  bool
+	isolated bool
+	metadata map[string]string
+}
+
+// instanceStates are the states of the Kitex instances of a resolution.
+type instanceStates struct {
+	byInstance map[discovery.Instance]instanceState
+}
+
+func newInstanceStates(size int) *instanceStates {
+	return &instanceStates{byInstance: make(map[discovery.Instance]instanceState, size)}
+}
+
+// add records the state of instance, converted to ins.
+func (s *instanceStates) add(ins discovery.Instance, instance model.Instance) {
+	s.byInstance[ins] = stateOf(instance)
+}
+
+// stateOf returns the state of a polaris instance.
+func stateOf(instance model.Instance) instanceState {
+	return instanceState{
+		id:       instance.GetId(),
+		revision: instance.GetRevision(),
+		healthy:  instance.IsHealthy(),
+		isolated: instance.IsIsolated(),
+		metadata: instance.GetMetadata(),
+	}
+}
+
+// updated reports whether next, the state of an instance at the same address and with the same
+// network and weight, is an update of s.
+func (s instanceState) updated(next instanceState) bool {
+	if s.id != next.id {
+		// another polaris instance took the address.
+		return true
+	}
+	if s.revision != "" && next.revision != "" {
+		return s.revision != next.revision
+	}
+	return s.healthy != next.healthy || s.isolated != next.isolated || !equalMetadata(s.metadata, next.metadata)
+}
+
+// diffStateRetention is how long the states of a superseded resolution are kept, longer than the
+// refresh interval of the Kitex balancers, 5s by default, whose last result Diff compares.
+const diffStateRetention = time.Minute
+
+// diffStates keeps, per description, the instance states of the last resolution and those of the resolutions
+// superseded within diffStateRetention, so that the results cached by every balancer can be diffed.
+type diffStates struct {
+	lock   sync.RWMutex
+	byDesc map[string]*descStates
+}
+
+// descStates are the instance states of the resolutions of a description.
+type descStates struct {
+	current    *instanceStates
+	superseded []supersededStates
+}
+
+type supersededStates struct {
+	states *instanceStates
+	at     time.Time
+}
+
+func newDiffStates() *diffStates {
+	return &diffStates{byDesc: make(map[string]*descStates)}
+}
+
+// record makes states the last resolution of desc.
+func (d *diffStates) record(desc string, states *instanceStates) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	last, ok := d.byDesc[desc]
+	if !ok {
+		d.byDesc[desc] = &descStates{current: states}
+		return
+	}
+	if last.current == states {
+		return
+	}
+	now := time.Now()
+	kept := last.superseded[:0]
+	for _, s := range last.superseded {
+		if now.Sub(s.at) < diffStateRetention {
+			kept = append(kept, s)
+		}
+	}
+	last.superseded = append(kept, supersededStates{states: last.current, at: now})
+	last.current = states
+}
+
+// get returns the state of ins, resolved for desc.
+func (d *diffStates) get(desc string, ins discovery.Instance) (instanceState, bool) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	last, ok := d.byDesc[desc]
+	if !ok {
+		return instanceState{}, false
+	}
+	if state, ok := last.current.byInstance[ins]; ok {
+		return state, true
+	}
+	for i := len(last.superseded) - 1; i >= 0; i-- {
+		if state, ok := last.superseded[i].states.byInstance[ins]; ok {
+			return state, true
+		}
+	}
+	return instanceState{}, false
+}
+
+// instanceStater is implemented by the resolvers knowing the polaris state of the instances they resolve.
+type instanceStater interface {
+	instanceState(desc string, ins discovery.Instance) (instanceState, bool)
+}
+
+// resolverInstanceState returns the state of ins, resolved for desc by r.
+func resolverInstanceState(r discovery.Resolver, desc string, ins discovery.Instance) (instanceState, bool) {
+	if stater, ok := r.(instanceStater); ok {
+		return stater.instanceState(desc, ins)
+	}
+	return instanceState{}, false
+}
+
+// diffResults computes the change between two results of a description.
+//
+// Kitex knows instances by address, so the instances are matched by address. Two polaris instances,
+// whose states are returned by state, at the same address differ when their IDs differ, or when their
+// revisions differ. Without revisions their weight, health, isolation and metadata are compared.
+// When the state of one instance only is known, their weight and the tags of its metadata are compared.
+// Otherwise, as for the static instances, the instances differ when their network or weight differ.
+func diffResults(cacheKey string, prev, next discovery.Result,
+	state func(ins discovery.Instance) (instanceState, bool)) (discovery.Change, bool) {
+	change := discovery.Change{
+		Result: discovery.Result{
+			Cacheable: next.Cacheable,
+			CacheKey:  cacheKey,
+			Instances: next.Instances,
+		},
+	}
+
+	prevByAddr := make(map[string]discovery.Instance, len(prev.Instances))
+	for _, ins := range prev.Instances {
+		prevByAddr[ins.Address().String()] = ins
+	}
+	nextAddrs := make(map[string]struct{}, len(next.Instances))
+	for _, ins := range next.Instances {
+		addr := ins.Address().String()
+		nextAddrs[addr] = struct{}{}
+		former, ok := prevByAddr[addr]
+		if !ok {
+			change.Added = append(change.Added, ins)
+		} else if instanceUpdated(former, ins, state) {
+			change.Updated = append(change.Updated, ins)
+		}
+	}
+	for _, ins := range prev.Instances {
+		if _, ok := nextAddrs[ins.Address().String()]; !ok {
+			change.Removed = append(change.Removed, ins)
+		}
+	}
+	return change, len(change.Added)+len(change.Updated)+len(change.Removed) != 0
+}
+
+// instanceUpdated reports whether next, at the address of prev, is an update of prev.
+func instanceUpdated(prev, next discovery.Instance, state func(ins discovery.Instance) (instanceState, bool)) bool {
+	if prev == next {
+		return false
+	}
+	if prev.Address().Network() != next.Address().Network() || prev.Weight() != next.Weight() {
+		return true
+	}
+	p, prevOK := state(prev)
+	n, nextOK := state(next)
+	switch {
+	case !prevOK && !nextOK:
+		return false
+	case !nextOK:
+		return tagsUpdated(p, next)
+	case !prevOK:
+		return tagsUpdated(n, prev)
+	}
+	return p.updated(n)
+}
+
+// tagsUpdated reports whether the tags of ins differ from the metadata of the polaris instance of known,
+// the only tags of ins that can be read.
+func tagsUpdated(known instanceState, ins discovery.Instance) bool {
+	for k, v := range known.metadata {
+		if tag, ok := ins.Tag(k); !ok || tag != v {
+			return true
+		}
+	}
+	return false
+}
+
+// equalMetadata reports whether two metadata hold the same entries.
+func equalMetadata(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/discovery"
+	"github.com/cloudwego/kitex/pkg/registry"
+	"github.com/cloudwego/kitex/pkg/utils"
+	"github.com/kitex-contrib/registry-polaris/polaristest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	server := polaristest.NewServer()
+	rg := NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI())
+	rs := NewPolarisResolverByAPI(server.ProviderAPI(), server.ConsumerAPI())
+	register := func(addr string) *registry.Info {
+		info := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", addr)}
+		require.Nil(t, rg.Register(info))
+		return info
+	}
+	first, second, third := register("127.0.0.1:6666"), register("127.0.0.1:7777"), register("127.0.0.1:8888")
+	defer rg.Deregister(first)
+	defer rg.Deregister(second)
+	desc := polarisDefaultNamespace + ":" + serviceName
+	prev, err := rs.Resolve(context.Background(), desc)
+	require.Nil(t, err)
+
+	require.True(t, server.UpdateInstance(polarisDefaultNamespace, serviceName, "127.0.0.1", 6666,
+		func(ins *polaristest.Instance) { ins.Weight = 50 }))
+	require.Nil(t, rg.Deregister(third))
+	fourth := register("127.0.0.1:9999")
+	defer rg.Deregister(fourth)
+	next, err := rs.Resolve(context.Background(), desc)
+	require.Nil(t, err)
+
+	change, ok := rs.Diff(desc, prev, next)
+	require.True(t, ok)
+	require.Equal(t, next.Instances, change.Result.Instances)
+	require.Equal(t, []string{"127.0.0.1:9999"}, addresses(change.Added))
+	require.Equal(t, []string{"127.0.0.1:6666"}, addresses(change.Updated))
+	require.Equal(t, 50, change.Updated[0].Weight())
+	require.Equal(t, []string{"127.0.0.1:8888"}, addresses(change.Removed))
+
+	// the metadata only changes, so does the revision.
+	require.True(t, server.UpdateInstance(polarisDefaultNamespace, serviceName, "127.0.0.1", 7777,
+		func(ins *polaristest.Instance) { ins.Metadata = map[string]string{"env": "test"} }))
+	last, err := rs.Resolve(context.Background(), desc)
+	require.Nil(t, err)
+	change, ok = rs.Diff(desc, next, last)
+	require.True(t, ok)
+	require.Empty(t, change.Added)
+	require.Equal(t, []string{"127.0.0.1:7777"}, addresses(change.Updated))
+	require.Empty(t, change.Removed)
+
+	_, ok = rs.Diff(desc, last, last)
+	require.False(t, ok)
+
+	// another balancer resolving in between does not hide the change.
+	require.True(t, server.UpdateInstance(polarisDefaultNamespace, serviceName, "127.0.0.1", 7777,
+		func(ins *polaristest.Instance) { ins.Metadata = map[string]string{"env": "prod"} }))
+	_, err = rs.Resolve(context.Background(), desc)
+	require.Nil(t, err)
+	require.True(t, server.UpdateInstance(polarisDefaultNamespace, serviceName, "127.0.0.1", 7777,
+		func(ins *polaristest.Instance) { ins.Metadata = map[string]string{"env": "test"} }))
+	interleaved, err := rs.Resolve(context.Background(), desc)
+	require.Nil(t, err)
+	change, ok = rs.Diff(desc, last, interleaved)
+	require.True(t, ok)
+	require.Equal(t, []string{"127.0.0.1:7777"}, addresses(change.Updated))
+}
+
+func TestDiffWithoutRevision(t *testing.T) {
+	states := newInstanceStates(0)
+	instance := func(id string, weight int, healthy bool, metadata map[string]string) discovery.Instance {
+		polarisInstance := &polaristest.Instance{
+			ID: id, Host: "127.0.0.1", Port: 6666, Protocol: "tcp", Weight: weight, Healthy: healthy, Metadata: metadata,
+		}
+		ins := ChangePolarisInstanceToKitex(polarisInstance)
+		states.add(ins, polarisInstance)
+		return ins
+	}
+	diff := func(prev, next discovery.Instance) bool {
+		_, ok := diffResults("", discovery.Result{Instances: []discovery.Instance{prev}},
+			discovery.Result{Instances: []discovery.Instance{next}}, func(ins discovery.Instance) (instanceState, bool) {
+				state, ok := states.byInstance[ins]
+				return state, ok
+			})
+		return ok
+	}
+
+	former := instance("1", 10, true, map[string]string{"env": "test"})
+	require.False(t, diff(former, instance("1", 10, true, map[string]string{"env": "test"})))
+	require.True(t, diff(former, instance("2", 10, true, map[string]string{"env": "test"})))
+	require.True(t, diff(former, instance("1", 20, true, map[string]string{"env": "test"})))
+	require.True(t, diff(former, instance("1", 10, false, map[string]string{"env": "test"})))
+	require.True(t, diff(former, instance("1", 10, true, map[string]string{"env": "prod"})))
+
+	// the static instances only have a weight.
+	static := discovery.NewInstance("tcp", "127.0.0.1:6666", 10, nil)
+	require.False(t, diff(static, discovery.NewInstance("tcp", "127.0.0.1:6666", 10, nil)))
+	require.True(t, diff(static, discovery.NewInstance("tcp", "127.0.0.1:6666", 20, nil)))
+	require.True(t, diff(static, instance("1", 20, true, nil)))
+	// without the state of one instance, the tags of the other are compared.
+	require.True(t, diff(static, former))
+	require.False(t, diff(discovery.NewInstance("tcp", "127.0.0.1:6666", 10, map[string]string{"env": "test"}), former))
+	require.True(t, diff(former, discovery.NewInstance("tcp", "127.0.0.1:6666", 10, map[string]string{"env": "prod"})))
+}
+
+func TestDiffStatesRetention(t *testing.T) {
+	d := newDiffStates()
+	ins := discovery.NewInstance("tcp", "127.0.0.1:6666", 10, nil)
+	first := newInstanceStates(1)
+	first.add(ins, &polaristest.Instance{ID: "1"})
+	d.record("desc", first)
+	for i := 0; i < 10; i++ {
+		d.record("desc", newInstanceStates(0))
+	}
+	state, ok := d.get("desc", ins)
+	require.True(t, ok)
+	require.Equal(t, "1", state.id)
+
+	d.byDesc["desc"].superseded[0].at = time.Now().Add(-diffStateRetention)
+	d.record("desc", newInstanceStates(0))
+	_, ok = d.get("desc", ins)
+	require.False(t, ok)
+}
+
+func TestTaggedDiff(t *testing.T) {
+	server := polaristest.NewServer()
+	rg := NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI())
+	info := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+	require.Nil(t, rg.Register(info))
+	defer rg.Deregister(info)
+	federated, err := NewFederatedResolver(MergeUnion, FederatedCluster{
+		Name:     "local",
+		Resolver: NewPolarisResolverByAPI(server.ProviderAPI(), server.ConsumerAPI()),
+	})
+	require.Nil(t, err)
+	migration := NewMigrationResolver(MergePreferLocal, NewPolarisResolverByAPI(server.ProviderAPI(), server.ConsumerAPI()),
+		NewPolarisResolverByAPI(server.ProviderAPI(), server.ConsumerAPI()))
+	desc := polarisDefaultNamespace + ":" + serviceName
+
+	for _, rs := range []Resolver{federated, migration} {
+		prev, err := rs.Resolve(context.Background(), desc)
+		require.Nil(t, err)
+		same, err := rs.Resolve(context.Background(), desc)
+		require.Nil(t, err)
+		_, ok := rs.Diff(desc, prev, same)
+		require.False(t, ok)
+
+		// the metadata only changes, the instances are told apart by their polaris revision.
+		require.True(t, server.UpdateInstance(polarisDefaultNamespace, serviceName, "127.0.0.1", 6666,
+			func(ins *polaristest.Instance) { ins.Metadata = map[string]string{"env": rs.Name()} }))
+		next, err := rs.Resolve(context.Background(), desc)
+		require.Nil(t, err)
+		change, ok := rs.Diff(desc, prev, next)
+		require.True(t, ok, rs.Name())
+		require.Equal(t, []string{"127.0.0.1:6666"}, addresses(change.Updated))
+	}
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"strconv"
+
+	"github.com/polarismesh/polaris-go/api"
+)
+
+// RegistryEventType is the type of a RegistryEvent.
+type RegistryEventType int
+
+const (
+	// EventRegistered is sent when the registration of an instance to polaris completes,
+	// after the readiness check when there is one. Err is set when it failed.
+	EventRegistered RegistryEventType = iota + 1
+	// EventHeartbeatFailed is sent when a heartbeat of an instance fails.
+	EventHeartbeatFailed
+	// EventReregistered is sent when an instance drifted in polaris is registered again, Err is set when it failed.
+	EventReregistered
+	// EventDeregistered is sent when the deregistration of an instance from polaris completes, Err is set when it failed.
+	EventDeregistered
+)
+
+// String implements the fmt.Stringer interface.
+func (t RegistryEventType) String() string {
+	switch t {
+	case EventRegistered:
+		return "Registered"
+	case EventHeartbeatFailed:
+		return "HeartbeatFailed"
+	case EventReregistered:
+		return "Reregistered"
+	case EventDeregistered:
+		return "Deregistered"
+	}
+	return "RegistryEventType(" + strconv.Itoa(int(t)) + ")"
+}
+
+// RegistryEvent is a lifecycle event of an instance of a polaris registry.
+type RegistryEvent struct {
+	Type        RegistryEventType
+	InstanceKey string
+	// Request is the registration of the instance, it must not be modified.
+	Request *api.InstanceRegisterRequest
+	Err     error
+}
+
+// RegistryObserver is notified of the lifecycle events of the instances of a polaris registry.
+// OnRegistryEvent is called from the goroutine of the operation, without any registry lock held,
+// so it may call the registry but should return quickly.
+type RegistryObserver interface {
+	OnRegistryEvent(event RegistryEvent)
+}
+
+// RegistryObserverFunc is a func implementing RegistryObserver.
+type RegistryObserverFunc func(event RegistryEvent)
+
+// OnRegistryEvent implements the RegistryObserver interface.
+func (f RegistryObserverFunc) OnRegistryEvent(event RegistryEvent) {
+	f(event)
+}
+
+// observableRegistry is a registry whose observers can be added once it is created.
+type observableRegistry interface {
+	addObserver(observer RegistryObserver)
+}
+
+// addObserver implements the observableRegistry interface.
+func (svr *polarisRegistry) addObserver(observer RegistryObserver) {
+	svr.lock.Lock()
+	defer svr.lock.Unlock()
+	svr.observers = append(svr.observers, observer)
+}
+
+// notify sends an event to the observers, it must be called without svr.lock held.
+func (svr *polarisRegistry) notify(eventType RegistryEventType, instanceKey string, req *api.InstanceRegisterRequest, err error) {
+	svr.lock.RLock()
+	observers := svr.observers
+	svr.lock.RUnlock()
+	if len(observers) == 0 {
+		return
+	}
+	event := RegistryEvent{Type: eventType, InstanceKey: instanceKey, Request: req, Err: err}
+	for _, observer := range observers {
+		observer.OnRegistryEvent(event)
+	}
+}
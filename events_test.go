@@ -0,0 +1,126 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/registry"
+	"github.com/cloudwego/kitex/pkg/utils"
+	"github.com/kitex-contrib/registry-polaris/polaristest"
+	"github.com/polarismesh/polaris-go/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryObserver(t *testing.T) {
+	formerHeartbeatTime := heartbeatTime
+	heartbeatTime = 10 * time.Millisecond
+	defer func() { heartbeatTime = formerHeartbeatTime }()
+
+	server := polaristest.NewServer()
+	events := make(chan RegistryEvent, 16)
+	var rg Registry
+	rg = NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI(), WithInfoWeight(),
+		WithReconcile(ReconcileConfig{Interval: 10 * time.Millisecond}),
+		WithRegistryObserver(RegistryObserverFunc(func(event RegistryEvent) {
+			// the registry can be used from observers, no lock is held.
+			rg.(*polarisRegistry).debugState()
+			events <- event
+		})))
+	info := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666"), Weight: 50}
+	key := GetInstanceKey(polarisDefaultNamespace, serviceName, "127.0.0.1", "6666")
+	next := func() RegistryEvent {
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(time.Second):
+			require.FailNow(t, "no event")
+			return RegistryEvent{}
+		}
+	}
+
+	require.Nil(t, rg.Register(info))
+	event := next()
+	require.Equal(t, EventRegistered, event.Type)
+	require.Equal(t, key, event.InstanceKey)
+	require.Equal(t, 50, *event.Request.Weight)
+	require.Nil(t, event.Err)
+
+	server.InjectError(polaristest.OpHeartbeat, model.NewSDKError(model.ErrCodeNetworkError, nil, "network"), 1)
+	event = next()
+	require.Equal(t, EventHeartbeatFailed, event.Type)
+	require.NotNil(t, event.Err)
+
+	server.UpdateInstance(polarisDefaultNamespace, serviceName, "127.0.0.1", 6666, func(ins *polaristest.Instance) {
+		ins.Weight = 1
+	})
+	event = next()
+	require.Equal(t, EventReregistered, event.Type)
+	require.Nil(t, event.Err)
+
+	require.Nil(t, rg.Deregister(info))
+	event = next()
+	require.Equal(t, EventDeregistered, event.Type)
+	require.Equal(t, key, event.InstanceKey)
+	require.Nil(t, event.Err)
+	require.Equal(t, "Deregistered", event.Type.String())
+}
+
+func TestObserverDeregisters(t *testing.T) {
+	formerHeartbeatTime := heartbeatTime
+	heartbeatTime = 10 * time.Millisecond
+	defer func() { heartbeatTime = formerHeartbeatTime }()
+
+	server := polaristest.NewServer()
+	info := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666"), Weight: 50}
+	errs := make(chan error, 4)
+	var rg Registry
+	rg = NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI(), WithInfoWeight(),
+		WithReconcile(ReconcileConfig{Interval: 10 * time.Millisecond}),
+		WithRegistryObserver(RegistryObserverFunc(func(event RegistryEvent) {
+			// the instance lock is released before the observers run.
+			switch {
+			case event.Type == EventReregistered:
+				errs <- rg.Deregister(info)
+			case event.Type == EventDeregistered && event.Err != nil:
+				errs <- rg.Deregister(info)
+			}
+		})))
+	next := func() error {
+		select {
+		case err := <-errs:
+			return err
+		case <-time.After(time.Second):
+			require.FailNow(t, "observer blocked")
+			return nil
+		}
+	}
+
+	require.Nil(t, rg.Register(info))
+	server.UpdateInstance(polarisDefaultNamespace, serviceName, "127.0.0.1", 6666, func(ins *polaristest.Instance) {
+		ins.Weight = 1
+	})
+	require.Nil(t, next())
+	require.Empty(t, server.Instances(polarisDefaultNamespace, serviceName))
+
+	require.Nil(t, rg.Register(info))
+	server.InjectError(polaristest.OpDeregister, model.NewSDKError(model.ErrCodeNetworkError, nil, "network"), 1)
+	require.NotNil(t, rg.Deregister(info))
+	require.Nil(t, next())
+	require.Empty(t, server.Instances(polarisDefaultNamespace, serviceName))
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/discovery"
+)
+
+// StaticInstance is a fixed instance, the network defaults to tcp and the weight to 10.
+type StaticInstance struct {
+	Network string            `json:"network,omitempty"`
+	Address string            `json:"address"`
+	Weight  int               `json:"weight,omitempty"`
+	Tags    map[string]string `json:"tags,omitempty"`
+}
+
+// StaticFallbackConfig holds the instances used, per description like "default:echo",
+// when polaris fails or returns no instance.
+type StaticFallbackConfig struct {
+	// Instances are the fallback instances set in code.
+	Instances map[string][]StaticInstance
+	// File is a JSON object mapping descriptions to instance lists, its lists override those of Instances.
+	// It is parsed again when it changes, so that it can be edited without restarting clients.
+	File string
+}
+
+// LoadStaticInstances reads a JSON object mapping descriptions to instance lists.
+func LoadStaticInstances(file string) (map[string][]StaticInstance, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	instances := make(map[string][]StaticInstance)
+	if err := json.Unmarshal(data, &instances); err != nil {
+		return nil, err
+	}
+	return instances, nil
+}
+
+// staticFallback serves the static instances of a resolver, the File is parsed only when it changes.
+type staticFallback struct {
+	cfg     *StaticFallbackConfig
+	logger  Logger
+	metrics *metrics
+
+	lock sync.Mutex
+	// modTime and size identify the parsed version of the File.
+	modTime       time.Time
+	size          int64
+	fileInstances map[string][]StaticInstance
+	// loadErr is the last failure to load the File, it is logged when it changes.
+	loadErr string
+}
+
+func newStaticFallback(cfg *StaticFallbackConfig, logger Logger, metrics *metrics) *staticFallback {
+	return &staticFallback{cfg: cfg, logger: logger, metrics: metrics}
+}
+
+// loadFile returns the instances of the File, parsing it when it changed since the last call.
+func (f *staticFallback) loadFile() map[string][]StaticInstance {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	stat, err := os.Stat(f.cfg.File)
+	if err == nil && stat.ModTime().Equal(f.modTime) && stat.Size() == f.size {
+		return f.fileInstances
+	}
+	f.modTime, f.size, f.fileInstances = time.Time{}, 0, nil
+	if err == nil {
+		f.fileInstances, err = LoadStaticInstances(f.cfg.File)
+		// a malformed File is not parsed again until it changes.
+		f.modTime, f.size = stat.ModTime(), stat.Size()
+	}
+	if err == nil {
+		f.loadErr = ""
+	} else if err.Error() != f.loadErr {
+		f.loadErr = err.Error()
+		if os.IsNotExist(err) {
+			f.logger.Warn("static instances file does not exist", "file", f.cfg.File)
+		} else {
+			f.logger.Error("fail to load static instances", "file", f.cfg.File, "err", err)
+		}
+	}
+	return f.fileInstances
+}
+
+// lookup returns the static instances of desc.
+func (f *staticFallback) lookup(desc string) []StaticInstance {
+	if f.cfg.File != "" {
+		if list, ok := f.loadFile()[desc]; ok {
+			return list
+		}
+	}
+	return f.cfg.Instances[desc]
+}
+
+// fallback returns the static instances of desc when there are some.
+func (f *staticFallback) fallback(desc string, cause error) (discovery.Result, bool) {
+	list := f.lookup(desc)
+	if len(list) == 0 {
+		return discovery.Result{}, false
+	}
+	instances := make([]discovery.Instance, 0, len(list))
+	for _, ins := range list {
+		network, weight := ins.Network, ins.Weight
+		if network == "" {
+			network = "tcp"
+		}
+		if weight <= 0 {
+			weight = defaultWeight
+		}
+		instances = append(instances, discovery.NewInstance(network, ins.Address, weight, ins.Tags))
+	}
+	namespace, service := SplitDescription(desc)
+	f.metrics.addStaticFallback(namespace, service)
+	f.logger.Warn("use static instances", "desc", desc, "count", len(instances), "cause", cause)
+	return discovery.Result{
+		Cacheable: true,
+		CacheKey:  desc,
+		Instances: instances,
+	}, true
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/discovery"
+	"github.com/cloudwego/kitex/pkg/registry"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"github.com/cloudwego/kitex/pkg/utils"
+	"github.com/kitex-contrib/registry-polaris/polaristest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolverStaticFallback(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "fallback.json")
+	m := newRecordMetrics()
+	server := polaristest.NewServer()
+	rg := NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI())
+	rs := NewPolarisResolverByAPI(server.ProviderAPI(), server.ConsumerAPI(), WithResolverMetrics(m),
+		WithStaticFallback(StaticFallbackConfig{
+			Instances: map[string][]StaticInstance{
+				"default:" + serviceName: {{Address: "10.0.0.1:8888"}},
+			},
+			File: file,
+		}))
+	desc := rs.Target(context.TODO(), rpcinfo.NewEndpointInfo(serviceName, "", nil, nil))
+	count := func() int {
+		return m.get(m.fallbacks, polarisDefaultNamespace, serviceName)
+	}
+	before := count()
+
+	// the service is unknown to polaris.
+	result, err := rs.Resolve(context.TODO(), desc)
+	require.Nil(t, err)
+	require.Equal(t, []discovery.Instance{discovery.NewInstance("tcp", "10.0.0.1:8888", defaultWeight, nil)}, result.Instances)
+	require.Equal(t, before+1, count())
+
+	// the file overrides the instances set in code.
+	require.Nil(t, ioutil.WriteFile(file, []byte(`{"default:`+serviceName+`": [{"address": "10.0.0.2:8888", "weight": 5}]}`), 0o644))
+	result, err = rs.Resolve(context.TODO(), desc)
+	require.Nil(t, err)
+	require.Equal(t, []discovery.Instance{discovery.NewInstance("tcp", "10.0.0.2:8888", 5, nil)}, result.Instances)
+
+	info := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+	require.Nil(t, rg.Register(info))
+	result, err = rs.Resolve(context.TODO(), desc)
+	require.Nil(t, err)
+	require.Equal(t, "127.0.0.1:6666", result.Instances[0].Address().String())
+	require.Equal(t, before+2, count())
+
+	// no instance remains.
+	require.Nil(t, rg.Deregister(info))
+	result, err = rs.Resolve(context.TODO(), desc)
+	require.Nil(t, err)
+	require.Equal(t, "10.0.0.2:8888", result.Instances[0].Address().String())
+	require.Equal(t, before+3, count())
+}
+
+func TestStaticFallbackFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "fallback.json")
+	logger := &recordLogger{}
+	f := newStaticFallback(&StaticFallbackConfig{File: file}, logger, nil)
+	desc := "default:" + serviceName
+
+	// a missing file is reported once.
+	require.Empty(t, f.lookup(desc))
+	require.Empty(t, f.lookup(desc))
+	require.Len(t, logger.entries, 1)
+	require.Equal(t, "warn", logger.entries[0].level)
+
+	content := []byte(`{"default:` + serviceName + `": [{"address": "10.0.0.2:8888"}]}`)
+	require.Nil(t, ioutil.WriteFile(file, content, 0o644))
+	require.Equal(t, []StaticInstance{{Address: "10.0.0.2:8888"}}, f.lookup(desc))
+
+	// the file is not parsed again while it is unchanged.
+	stat, err := os.Stat(file)
+	require.Nil(t, err)
+	invalid := make([]byte, len(content))
+	for i := range invalid {
+		invalid[i] = '!'
+	}
+	require.Nil(t, ioutil.WriteFile(file, invalid, 0o644))
+	require.Nil(t, os.Chtimes(file, stat.ModTime(), stat.ModTime()))
+	require.Equal(t, []StaticInstance{{Address: "10.0.0.2:8888"}}, f.lookup(desc))
+
+	require.Nil(t, os.Chtimes(file, stat.ModTime().Add(time.Second), stat.ModTime().Add(time.Second)))
+	require.Empty(t, f.lookup(desc))
+	require.Empty(t, f.lookup(desc))
+	require.Len(t, logger.entries, 2)
+	require.Equal(t, "error", logger.entries[1].level)
+}
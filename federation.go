@@ -0,0 +1,323 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/cloudwego/kitex/pkg/discovery"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"github.com/polarismesh/polaris-go/api"
+)
+
+// ClusterTag is the tag holding the name of the polaris cluster an instance is discovered in.
+const ClusterTag = "polaris_cluster"
+
+// MergePolicy decides how the instances of several polaris clusters are merged.
+type MergePolicy int
+
+const (
+	// MergePreferLocal uses the instances of the local cluster, the first one, or
+	// the union of the other clusters when the local one has no instance.
+	MergePreferLocal MergePolicy = iota
+	// MergeUnion uses the instances of every cluster.
+	MergeUnion
+	// MergeFailover uses the instances of the first cluster, in order, that has some.
+	MergeFailover
+)
+
+// FederatedCluster is a polaris cluster of a federated resolver.
+type FederatedCluster struct {
+	// Name is set as the ClusterTag tag of the instances of the cluster.
+	Name     string
+	Resolver Resolver
+}
+
+// NewFederatedCluster creates the cluster name discovered through sdkCtx.
+func NewFederatedCluster(name string, sdkCtx api.SDKContext, opts ...ResolverOption) FederatedCluster {
+	return FederatedCluster{Name: name, Resolver: NewPolarisResolverByContext(sdkCtx, opts...)}
+}
+
+// federatedResolver discovers services across several polaris clusters.
+type federatedResolver struct {
+	policy   MergePolicy
+	clusters []FederatedCluster
+	watched  *mergedWatch
+}
+
+// NewFederatedResolver creates a resolver merging the instances of clusters according to policy.
+// The first cluster is the local one, at least one cluster is required.
+func NewFederatedResolver(policy MergePolicy, clusters ...FederatedCluster) (Resolver, error) {
+	if len(clusters) == 0 {
+		return nil, errors.New("no cluster to federate")
+	}
+	return &federatedResolver{
+		policy:   policy,
+		clusters: clusters,
+		watched:  newMergedWatch(policy),
+	}, nil
+}
+
+// Target implements the Resolver interface.
+func (f *federatedResolver) Target(ctx context.Context, target rpcinfo.EndpointInfo) string {
+	return f.clusters[0].Resolver.Target(ctx, target)
+}
+
+// clusterResult is the resolution of a description in one cluster.
+type clusterResult struct {
+	instances []discovery.Instance
+	err       error
+}
+
+// Resolve implements the Resolver interface.
+func (f *federatedResolver) Resolve(ctx context.Context, desc string) (discovery.Result, error) {
+	results := f.resolveClusters(ctx, desc)
+	instances := mergeResults(f.policy, results)
+	if len(instances) == 0 {
+		errs := make([]string, 0, len(results))
+		for i, result := range results {
+			if result.err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", f.clusters[i].Name, result.err))
+			}
+		}
+		return discovery.Result{}, fmt.Errorf("no instance remains for %s in any cluster: %s", desc, strings.Join(errs, "; "))
+	}
+	return discovery.Result{
+		Cacheable: true,
+		CacheKey:  desc,
+		Instances: instances,
+	}, nil
+}
+
+// resolveClusters resolves desc in every cluster.
+func (f *federatedResolver) resolveClusters(ctx context.Context, desc string) []clusterResult {
+	results := make([]clusterResult, len(f.clusters))
+	var wg sync.WaitGroup
+	for i := range f.clusters {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result, err := f.clusters[i].Resolver.Resolve(ctx, desc)
+			results[i] = clusterResult{instances: tagInstances(result.Instances, ClusterTag, f.clusters[i].Name), err: err}
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// mergeResults applies policy to the results of the clusters, the first one being the local one.
+func mergeResults(policy MergePolicy, results []clusterResult) []discovery.Instance {
+	switch policy {
+	case MergeUnion:
+		return union(results)
+	case MergeFailover:
+		for _, result := range results {
+			if len(result.instances) > 0 {
+				return result.instances
+			}
+		}
+		return nil
+	default:
+		if len(results[0].instances) > 0 {
+			return results[0].instances
+		}
+		return union(results[1:])
+	}
+}
+
+// union returns the instances of every result, the first one wins for an address found in several clusters.
+func union(results []clusterResult) []discovery.Instance {
+	var instances []discovery.Instance
+	seen := make(map[string]bool)
+	for _, result := range results {
+		for _, ins := range result.instances {
+			addr := ins.Address().String()
+			if seen[addr] {
+				continue
+			}
+			seen[addr] = true
+			instances = append(instances, ins)
+		}
+	}
+	return instances
+}
+
+// mergedWatch holds, per description, the merged instances last reported by the Watcher of
+// a resolver merging several ones, so that the changes follow the merge policy.
+type mergedWatch struct {
+	policy MergePolicy
+
+	lock    sync.Mutex
+	results map[string]discovery.Result
+}
+
+func newMergedWatch(policy MergePolicy) *mergedWatch {
+	return &mergedWatch{policy: policy, results: make(map[string]discovery.Result)}
+}
+
+// next waits for the changes reported by wait until the instances merged from resolve differ from those
+// last reported, and returns the difference computed by diff. The first call of a description only
+// records the instances before waiting.
+func (w *mergedWatch) next(ctx context.Context, desc string, wait func(ctx context.Context) error,
+	resolve func(ctx context.Context) []clusterResult,
+	diff func(cacheKey string, prev, next discovery.Result) (discovery.Change, bool)) (discovery.Change, error) {
+	merged := func() (discovery.Result, bool) {
+		results := resolve(ctx)
+		instances := mergeResults(w.policy, results)
+		if len(instances) == 0 {
+			for _, result := range results {
+				if result.err != nil {
+					// the instances are unknown rather than all removed.
+					return discovery.Result{}, false
+				}
+			}
+		}
+		return discovery.Result{Cacheable: true, CacheKey: desc, Instances: instances}, true
+	}
+	w.lock.Lock()
+	_, ok := w.results[desc]
+	w.lock.Unlock()
+	if !ok {
+		result, _ := merged()
+		w.lock.Lock()
+		if _, ok := w.results[desc]; !ok {
+			w.results[desc] = result
+		}
+		w.lock.Unlock()
+	}
+	for {
+		if err := wait(ctx); err != nil || ctx.Err() != nil {
+			if ctx.Err() != nil {
+				return discovery.Change{}, nil
+			}
+			return discovery.Change{}, err
+		}
+		result, ok := merged()
+		if !ok {
+			continue
+		}
+		w.lock.Lock()
+		change, changed := diff(desc, w.results[desc], result)
+		if changed {
+			w.results[desc] = result
+		}
+		w.lock.Unlock()
+		if changed {
+			return change, nil
+		}
+	}
+}
+
+// firstChange waits until one of watches, run concurrently, returns without error, which stops the others.
+// It returns the first error when they all fail.
+func firstChange(ctx context.Context, watches ...func(ctx context.Context) error) error {
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, len(watches))
+	for _, watch := range watches {
+		go func(watch func(ctx context.Context) error) {
+			errs <- watch(watchCtx)
+		}(watch)
+	}
+	var firstErr error
+	for range watches {
+		err := <-errs
+		if err == nil {
+			return nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Watcher implements the Resolver interface. It waits for a change in any cluster, and returns
+// the difference of the merged instances, changes hidden by the merge policy are skipped.
+func (f *federatedResolver) Watcher(ctx context.Context, desc string) (discovery.Change, error) {
+	watches := make([]func(ctx context.Context) error, 0, len(f.clusters))
+	for _, cluster := range f.clusters {
+		cluster := cluster
+		watches = append(watches, func(ctx context.Context) error {
+			if _, err := cluster.Resolver.Watcher(ctx, desc); err != nil {
+				return fmt.Errorf("%s: %w", cluster.Name, err)
+			}
+			return nil
+		})
+	}
+	return f.watched.next(ctx, desc, func(ctx context.Context) error {
+		return firstChange(ctx, watches...)
+	}, func(ctx context.Context) []clusterResult {
+		return f.resolveClusters(ctx, desc)
+	}, f.Diff)
+}
+
+// Diff implements the Resolver interface.
+func (f *federatedResolver) Diff(cacheKey string, prev, next discovery.Result) (discovery.Change, bool) {
+	return diffResults(cacheKey, prev, next, func(ins discovery.Instance) (instanceState, bool) {
+		return f.instanceState(cacheKey, ins)
+	})
+}
+
+// instanceState implements the instanceStater interface, the cluster resolvers know the states.
+func (f *federatedResolver) instanceState(desc string, ins discovery.Instance) (instanceState, bool) {
+	tagged, ok := ins.(*taggedInstance)
+	if !ok {
+		return instanceState{}, false
+	}
+	for _, cluster := range f.clusters {
+		if cluster.Name == tagged.value {
+			return resolverInstanceState(cluster.Resolver, desc, tagged.Instance)
+		}
+	}
+	return instanceState{}, false
+}
+
+// Name implements the Resolver interface.
+func (f *federatedResolver) Name() string {
+	return "PolarisFederation"
+}
+
+// taggedInstance is an instance with an extra tag, like the cluster it is discovered in.
+type taggedInstance struct {
+	discovery.Instance
+	key, value string
+}
+
+// Tag implements the discovery.Instance interface.
+func (i *taggedInstance) Tag(key string) (string, bool) {
+	if key == i.key {
+		return i.value, true
+	}
+	return i.Instance.Tag(key)
+}
+
+// tagInstances adds the tag key=value to instances.
+func tagInstances(instances []discovery.Instance, key, value string) []discovery.Instance {
+	if len(instances) == 0 {
+		return nil
+	}
+	tagged := make([]discovery.Instance, 0, len(instances))
+	for _, ins := range instances {
+		tagged = append(tagged, &taggedInstance{Instance: ins, key: key, value: value})
+	}
+	return tagged
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/discovery"
+	"github.com/cloudwego/kitex/pkg/registry"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"github.com/cloudwego/kitex/pkg/utils"
+	"github.com/kitex-contrib/registry-polaris/polaristest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFederatedResolver(t *testing.T) {
+	local, remote := polaristest.NewServer(), polaristest.NewServer()
+	localRg := NewPolarisRegistryByAPI(local.ProviderAPI(), local.ConsumerAPI())
+	remoteRg := NewPolarisRegistryByAPI(remote.ProviderAPI(), remote.ConsumerAPI())
+	clusters := []FederatedCluster{
+		{Name: "local", Resolver: NewPolarisResolverByAPI(local.ProviderAPI(), local.ConsumerAPI())},
+		{Name: "remote", Resolver: NewPolarisResolverByAPI(remote.ProviderAPI(), remote.ConsumerAPI())},
+	}
+	localInfo := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+	remoteInfo := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.2:6666")}
+	require.Nil(t, remoteRg.Register(remoteInfo))
+	defer remoteRg.Deregister(remoteInfo)
+
+	resolve := func(policy MergePolicy) map[string]string {
+		rs, err := NewFederatedResolver(policy, clusters...)
+		require.Nil(t, err)
+		desc := rs.Target(context.TODO(), rpcinfo.NewEndpointInfo(serviceName, "", nil, nil))
+		result, err := rs.Resolve(context.TODO(), desc)
+		require.Nil(t, err)
+		addrs := make(map[string]string)
+		for _, ins := range result.Instances {
+			addrs[ins.Address().String()], _ = ins.Tag(ClusterTag)
+		}
+		return addrs
+	}
+
+	// the local cluster does not know the service.
+	require.Equal(t, map[string]string{"127.0.0.2:6666": "remote"}, resolve(MergePreferLocal))
+	require.Equal(t, map[string]string{"127.0.0.2:6666": "remote"}, resolve(MergeFailover))
+
+	require.Nil(t, localRg.Register(localInfo))
+	defer localRg.Deregister(localInfo)
+	require.Equal(t, map[string]string{"127.0.0.1:6666": "local"}, resolve(MergePreferLocal))
+	require.Equal(t, map[string]string{"127.0.0.1:6666": "local"}, resolve(MergeFailover))
+	require.Equal(t, map[string]string{"127.0.0.1:6666": "local", "127.0.0.2:6666": "remote"}, resolve(MergeUnion))
+
+	rs, err := NewFederatedResolver(MergeUnion, clusters...)
+	require.Nil(t, err)
+	desc := rs.Target(context.TODO(), rpcinfo.NewEndpointInfo(serviceName, "", nil, nil))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	_, err = rs.Watcher(ctx, desc)
+	cancel()
+	require.Nil(t, err)
+	added := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.3:6666")}
+	require.Nil(t, remoteRg.Register(added))
+	defer remoteRg.Deregister(added)
+	change, err := rs.Watcher(context.TODO(), desc)
+	require.Nil(t, err)
+	require.Len(t, change.Added, 1)
+	cluster, _ := change.Added[0].Tag(ClusterTag)
+	require.Equal(t, "remote", cluster)
+	require.Len(t, change.Result.Instances, 3)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	change, err = rs.Watcher(ctx, desc)
+	require.Nil(t, err)
+	require.Equal(t, discovery.Change{}, change)
+}
+
+func TestFederatedResolverWithoutCluster(t *testing.T) {
+	_, err := NewFederatedResolver(MergeUnion)
+	require.NotNil(t, err)
+}
+
+// testFederatedWatcher checks the changes of a federated resolver over three clusters, each one with
+// an instance, the instances of the local cluster being removed at last.
+func testFederatedWatcher(t *testing.T, policy MergePolicy, failover []string) {
+	var clusters []FederatedCluster
+	var registries []registry.Registry
+	for _, name := range []string{"local", "first", "second"} {
+		server := polaristest.NewServer()
+		clusters = append(clusters, FederatedCluster{Name: name, Resolver: NewPolarisResolverByAPI(server.ProviderAPI(), server.ConsumerAPI())})
+		registries = append(registries, NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI()))
+	}
+	register := func(cluster int, host string) *registry.Info {
+		info := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", host+":6666")}
+		require.Nil(t, registries[cluster].Register(info))
+		return info
+	}
+	local := register(0, "127.0.0.1")
+	defer registries[1].Deregister(register(1, "127.0.0.2"))
+	defer registries[2].Deregister(register(2, "127.0.0.3"))
+	rs, err := NewFederatedResolver(policy, clusters...)
+	require.Nil(t, err)
+	desc := rs.Target(context.TODO(), rpcinfo.NewEndpointInfo(serviceName, "", nil, nil))
+	watch := func(timeout time.Duration) discovery.Change {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		change, err := rs.Watcher(ctx, desc)
+		require.Nil(t, err)
+		return change
+	}
+	// the first call starts watching.
+	require.Equal(t, discovery.Change{}, watch(50*time.Millisecond))
+
+	// the change of a remote cluster is hidden by the local instances.
+	defer registries[1].Deregister(register(1, "127.0.0.4"))
+	added := register(0, "127.0.0.5")
+	change := watch(time.Second)
+	require.Equal(t, []string{"127.0.0.5:6666"}, addresses(change.Added))
+	require.Empty(t, change.Updated)
+	require.Empty(t, change.Removed)
+
+	require.Nil(t, registries[0].Deregister(local))
+	require.Nil(t, registries[0].Deregister(added))
+	var adds, removes []string
+	for len(removes) < 2 {
+		change = watch(time.Second)
+		require.Empty(t, change.Updated)
+		adds = append(adds, addresses(change.Added)...)
+		removes = append(removes, addresses(change.Removed)...)
+	}
+	sort.Strings(adds)
+	sort.Strings(removes)
+	require.Equal(t, failover, adds)
+	require.Equal(t, []string{"127.0.0.1:6666", "127.0.0.5:6666"}, removes)
+	result := addresses(change.Result.Instances)
+	sort.Strings(result)
+	require.Equal(t, failover, result)
+}
+
+func TestFederatedWatcherPreferLocal(t *testing.T) {
+	testFederatedWatcher(t, MergePreferLocal, []string{"127.0.0.2:6666", "127.0.0.3:6666", "127.0.0.4:6666"})
+}
+
+func TestFederatedWatcherFailover(t *testing.T) {
+	testFederatedWatcher(t, MergeFailover, []string{"127.0.0.2:6666", "127.0.0.4:6666"})
+}
@@ -5,7 +5,10 @@ go 1.16
 require (
 	github.com/cloudwego/kitex v0.1.3
 	github.com/cloudwego/kitex-examples v0.0.0-20211103034154-ddf5b924924e
+	github.com/go-logr/logr v1.2.1
+	github.com/golang/protobuf v1.5.2
 	github.com/pkg/errors v0.9.1
 	github.com/polarismesh/polaris-go v1.0.1
 	github.com/stretchr/testify v1.7.0
+	google.golang.org/grpc v1.40.0
 )
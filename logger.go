@@ -0,0 +1,176 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/cloudwego/kitex/pkg/klog"
+	"github.com/go-logr/logr"
+	"github.com/polarismesh/polaris-go/pkg/log"
+)
+
+// Logger is a structured logger, keysAndValues alternate keys and values like "service", "echo".
+// A *slog.Logger satisfies it, the Kitex klog loggers are adapted by NewKlogLogger
+// and logr based loggers, like the one of k8s.io/klog/v2, by NewLogrLogger.
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+}
+
+var defaultLogger atomic.Value
+
+func init() {
+	SetLogger(NewPolarisLogger())
+}
+
+// SetLogger sets the logger of the registries and resolvers created without a logger option,
+// the polaris-go base logger by default.
+func SetLogger(logger Logger) {
+	defaultLogger.Store(&logger)
+}
+
+// GetLogger returns the logger set by SetLogger.
+func GetLogger() Logger {
+	return *defaultLogger.Load().(*Logger)
+}
+
+// globalLogger follows the logger set by SetLogger.
+type globalLogger struct{}
+
+func (globalLogger) Debug(msg string, keysAndValues ...interface{}) {
+	GetLogger().Debug(msg, keysAndValues...)
+}
+
+func (globalLogger) Info(msg string, keysAndValues ...interface{}) {
+	GetLogger().Info(msg, keysAndValues...)
+}
+
+func (globalLogger) Warn(msg string, keysAndValues ...interface{}) {
+	GetLogger().Warn(msg, keysAndValues...)
+}
+
+func (globalLogger) Error(msg string, keysAndValues ...interface{}) {
+	GetLogger().Error(msg, keysAndValues...)
+}
+
+// polarisLogger writes to the polaris-go base logger, fields are appended as key=value.
+type polarisLogger struct{}
+
+// NewPolarisLogger returns a logger writing to the polaris-go base logger.
+func NewPolarisLogger() Logger {
+	return polarisLogger{}
+}
+
+func (polarisLogger) Debug(msg string, keysAndValues ...interface{}) {
+	log.GetBaseLogger().Debugf("%s", formatFields(msg, keysAndValues))
+}
+
+func (polarisLogger) Info(msg string, keysAndValues ...interface{}) {
+	log.GetBaseLogger().Infof("%s", formatFields(msg, keysAndValues))
+}
+
+func (polarisLogger) Warn(msg string, keysAndValues ...interface{}) {
+	log.GetBaseLogger().Warnf("%s", formatFields(msg, keysAndValues))
+}
+
+func (polarisLogger) Error(msg string, keysAndValues ...interface{}) {
+	log.GetBaseLogger().Errorf("%s", formatFields(msg, keysAndValues))
+}
+
+// formatFields appends the fields to msg as key=value.
+func formatFields(msg string, keysAndValues []interface{}) string {
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		var value interface{} = "(MISSING)"
+		if i+1 < len(keysAndValues) {
+			value = keysAndValues[i+1]
+		}
+		fmt.Fprintf(&b, " %v=%v", keysAndValues[i], value)
+	}
+	return b.String()
+}
+
+// klogLogger adapts a Kitex klog logger, fields are appended as key=value.
+type klogLogger struct {
+	logger klog.FormatLogger
+}
+
+// NewKlogLogger adapts a Kitex klog logger, like klog.DefaultLogger().
+func NewKlogLogger(logger klog.FormatLogger) Logger {
+	return klogLogger{logger: logger}
+}
+
+func (l klogLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.logger.Debugf("%s", formatFields(msg, keysAndValues))
+}
+
+func (l klogLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.logger.Infof("%s", formatFields(msg, keysAndValues))
+}
+
+func (l klogLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.logger.Warnf("%s", formatFields(msg, keysAndValues))
+}
+
+func (l klogLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.logger.Errorf("%s", formatFields(msg, keysAndValues))
+}
+
+// logrLogger adapts a logr.Logger.
+type logrLogger struct {
+	logger logr.Logger
+}
+
+// NewLogrLogger adapts a logr.Logger, like klog.Background() of k8s.io/klog/v2.
+// Debug messages are logged at verbosity 1, warnings as info messages with a "severity" field,
+// logr having no warning level.
+func NewLogrLogger(logger logr.Logger) Logger {
+	return logrLogger{logger: logger}
+}
+
+func (l logrLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.logger.V(1).Info(msg, keysAndValues...)
+}
+
+func (l logrLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.logger.Info(msg, keysAndValues...)
+}
+
+func (l logrLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.logger.Info(msg, append(keysAndValues[:len(keysAndValues):len(keysAndValues)], "severity", "warn")...)
+}
+
+// Error passes the value of the "err" field as the error of the message.
+func (l logrLogger) Error(msg string, keysAndValues ...interface{}) {
+	var err error
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		if keysAndValues[i] == "err" {
+			if e, ok := keysAndValues[i+1].(error); ok {
+				err = e
+				keysAndValues = append(keysAndValues[:i:i], keysAndValues[i+2:]...)
+				break
+			}
+		}
+	}
+	l.logger.Error(err, msg, keysAndValues...)
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/cloudwego/kitex/pkg/klog"
+	"github.com/cloudwego/kitex/pkg/registry"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"github.com/cloudwego/kitex/pkg/utils"
+	"github.com/go-logr/logr/funcr"
+	"github.com/kitex-contrib/registry-polaris/polaristest"
+	"github.com/stretchr/testify/require"
+)
+
+type logEntry struct {
+	level  string
+	msg    string
+	fields []interface{}
+}
+
+// recordLogger records the entries logged.
+type recordLogger struct {
+	lock    sync.Mutex
+	entries []logEntry
+}
+
+func (l *recordLogger) record(level, msg string, fields []interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.entries = append(l.entries, logEntry{level: level, msg: msg, fields: fields})
+}
+
+func (l *recordLogger) Debug(msg string, kv ...interface{}) { l.record("debug", msg, kv) }
+func (l *recordLogger) Info(msg string, kv ...interface{})  { l.record("info", msg, kv) }
+func (l *recordLogger) Warn(msg string, kv ...interface{})  { l.record("warn", msg, kv) }
+func (l *recordLogger) Error(msg string, kv ...interface{}) { l.record("error", msg, kv) }
+
+func TestResolverLogger(t *testing.T) {
+	logger := &recordLogger{}
+	server := polaristest.NewServer()
+	rg := NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI())
+	rs := NewPolarisResolverByAPI(server.ProviderAPI(), server.ConsumerAPI(), WithResolverLogger(logger))
+	info := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+	require.Nil(t, rg.Register(info))
+	defer rg.Deregister(info)
+
+	desc := rs.Target(context.TODO(), rpcinfo.NewEndpointInfo(serviceName, "", nil, nil))
+	_, err := rs.Resolve(context.TODO(), desc)
+	require.Nil(t, err)
+	require.Equal(t, []logEntry{{
+		level: "debug",
+		msg:   "resolved instance",
+		fields: []interface{}{"namespace", polarisDefaultNamespace, "service", serviceName,
+			"host", "127.0.0.1", "port", uint32(6666)},
+	}}, logger.entries)
+}
+
+func TestLogrLogger(t *testing.T) {
+	var lines []string
+	logger := NewLogrLogger(funcr.New(func(prefix, args string) {
+		lines = append(lines, args)
+	}, funcr.Options{Verbosity: 1}))
+
+	logger.Debug("debug", "k", 1)
+	logger.Warn("warn", "k", 2)
+	logger.Error("error", "k", 3, "err", errors.New("boom"))
+	require.Equal(t, []string{
+		`"level"=1 "msg"="debug" "k"=1`,
+		`"level"=0 "msg"="warn" "k"=2 "severity"="warn"`,
+		`"msg"="error" "error"="boom" "k"=3`,
+	}, lines)
+}
+
+// formatRecorder records the lines of a klog.FormatLogger.
+type formatRecorder struct {
+	klog.FormatLogger
+	lines []string
+}
+
+func (r *formatRecorder) Debugf(format string, v ...interface{}) {
+	r.lines = append(r.lines, "debug "+fmt.Sprintf(format, v...))
+}
+
+func (r *formatRecorder) Warnf(format string, v ...interface{}) {
+	r.lines = append(r.lines, "warn "+fmt.Sprintf(format, v...))
+}
+
+func (r *formatRecorder) Errorf(format string, v ...interface{}) {
+	r.lines = append(r.lines, "error "+fmt.Sprintf(format, v...))
+}
+
+func TestKlogLogger(t *testing.T) {
+	recorder := &formatRecorder{}
+	logger := NewKlogLogger(recorder)
+
+	logger.Debug("debug", "k", 1)
+	logger.Warn("warn %d", "k", 2)
+	logger.Error("error", "k", 3, "err", errors.New("boom"))
+	require.Equal(t, []string{
+		"debug debug k=1",
+		"warn warn %d k=2",
+		"error error k=3 err=boom",
+	}, recorder.lines)
+}
+
+func TestFormatFields(t *testing.T) {
+	require.Equal(t, "msg a=1 b=(MISSING)", formatFields("msg", []interface{}{"a", 1, "b"}))
+}
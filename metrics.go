@@ -0,0 +1,167 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"time"
+
+	"github.com/polarismesh/polaris-go/api"
+	"github.com/polarismesh/polaris-go/pkg/model"
+)
+
+// The polaris operations reported to a MetricsRecorder.
+const (
+	OperationRegister        = "register"
+	OperationDeregister      = "deregister"
+	OperationHeartbeat       = "heartbeat"
+	OperationGetInstances    = "get_instances"
+	OperationGetAllInstances = "get_all_instances"
+	OperationWatchService    = "watch_service"
+)
+
+// MetricsRecorder records the metrics of polaris registries and resolvers, like the
+// Prometheus one of the github.com/kitex-contrib/registry-polaris/metrics/prometheus module.
+type MetricsRecorder interface {
+	// ObserveOperation records a polaris operation on a service, err is nil when it succeeded.
+	ObserveOperation(namespace, service, operation string, duration time.Duration, err error)
+	// AddRegistered changes the number of instances of a service registered to polaris by delta.
+	AddRegistered(namespace, service string, delta int)
+	// SetResolved sets the number of instances of a service in the last resolution.
+	SetResolved(namespace, service string, n int)
+	// AddStaticFallback counts a resolution of a service served by static instances.
+	AddStaticFallback(namespace, service string)
+}
+
+// metrics reports to a MetricsRecorder, a nil *metrics records nothing.
+type metrics struct {
+	recorder MetricsRecorder
+}
+
+func newMetrics(recorder MetricsRecorder) *metrics {
+	if recorder == nil {
+		return nil
+	}
+	return &metrics{recorder: recorder}
+}
+
+// observe records an operation started at start.
+func (m *metrics) observe(op, namespace, service string, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	m.recorder.ObserveOperation(namespace, service, op, time.Since(start), err)
+}
+
+// addRegistered changes the number of registered instances of a service by delta.
+func (m *metrics) addRegistered(namespace, service string, delta int) {
+	if m == nil {
+		return
+	}
+	m.recorder.AddRegistered(namespace, service, delta)
+}
+
+// setResolved sets the number of resolved instances of a service.
+func (m *metrics) setResolved(namespace, service string, n int) {
+	if m == nil {
+		return
+	}
+	m.recorder.SetResolved(namespace, service, n)
+}
+
+// addStaticFallback counts a resolution of a service served by static instances.
+func (m *metrics) addStaticFallback(namespace, service string) {
+	if m == nil {
+		return
+	}
+	m.recorder.AddStaticFallback(namespace, service)
+}
+
+// metricsProvider records the operations of a ProviderAPI.
+type metricsProvider struct {
+	api.ProviderAPI
+	metrics *metrics
+}
+
+// wrapProvider returns provider recording its operations.
+func (m *metrics) wrapProvider(provider api.ProviderAPI) api.ProviderAPI {
+	if m == nil {
+		return provider
+	}
+	return &metricsProvider{ProviderAPI: provider, metrics: m}
+}
+
+// Register implements the api.ProviderAPI interface.
+func (p *metricsProvider) Register(req *api.InstanceRegisterRequest) (*model.InstanceRegisterResponse, error) {
+	start := time.Now()
+	resp, err := p.ProviderAPI.Register(req)
+	p.metrics.observe(OperationRegister, req.Namespace, req.Service, start, err)
+	return resp, err
+}
+
+// Deregister implements the api.ProviderAPI interface.
+func (p *metricsProvider) Deregister(req *api.InstanceDeRegisterRequest) error {
+	start := time.Now()
+	err := p.ProviderAPI.Deregister(req)
+	p.metrics.observe(OperationDeregister, req.Namespace, req.Service, start, err)
+	return err
+}
+
+// Heartbeat implements the api.ProviderAPI interface.
+func (p *metricsProvider) Heartbeat(req *api.InstanceHeartbeatRequest) error {
+	start := time.Now()
+	err := p.ProviderAPI.Heartbeat(req)
+	p.metrics.observe(OperationHeartbeat, req.Namespace, req.Service, start, err)
+	return err
+}
+
+// metricsConsumer records the operations of a ConsumerAPI.
+type metricsConsumer struct {
+	api.ConsumerAPI
+	metrics *metrics
+}
+
+// wrapConsumer returns consumer recording its operations.
+func (m *metrics) wrapConsumer(consumer api.ConsumerAPI) api.ConsumerAPI {
+	if m == nil {
+		return consumer
+	}
+	return &metricsConsumer{ConsumerAPI: consumer, metrics: m}
+}
+
+// GetInstances implements the api.ConsumerAPI interface.
+func (c *metricsConsumer) GetInstances(req *api.GetInstancesRequest) (*model.InstancesResponse, error) {
+	start := time.Now()
+	resp, err := c.ConsumerAPI.GetInstances(req)
+	c.metrics.observe(OperationGetInstances, req.Namespace, req.Service, start, err)
+	return resp, err
+}
+
+// GetAllInstances implements the api.ConsumerAPI interface.
+func (c *metricsConsumer) GetAllInstances(req *api.GetAllInstancesRequest) (*model.InstancesResponse, error) {
+	start := time.Now()
+	resp, err := c.ConsumerAPI.GetAllInstances(req)
+	c.metrics.observe(OperationGetAllInstances, req.Namespace, req.Service, start, err)
+	return resp, err
+}
+
+// WatchService implements the api.ConsumerAPI interface.
+func (c *metricsConsumer) WatchService(req *api.WatchServiceRequest) (*model.WatchServiceResponse, error) {
+	start := time.Now()
+	resp, err := c.ConsumerAPI.WatchService(req)
+	c.metrics.observe(OperationWatchService, req.Key.Namespace, req.Key.Service, start, err)
+	return resp, err
+}
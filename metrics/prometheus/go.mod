@@ -0,0 +1,11 @@
+module github.com/kitex-contrib/registry-polaris/metrics/prometheus
+
+go 1.16
+
+require (
+	github.com/cloudwego/kitex v0.1.3
+	github.com/kitex-contrib/registry-polaris v0.0.0-20261019175307-8ed09391f773
+	github.com/polarismesh/polaris-go v1.0.1
+	github.com/prometheus/client_golang v1.12.1
+	github.com/stretchr/testify v1.7.0
+)
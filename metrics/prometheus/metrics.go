@@ -0,0 +1,103 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package prometheus reports the metrics of the polaris registries and resolvers to Prometheus.
+package prometheus
+
+import (
+	"time"
+
+	polaris "github.com/kitex-contrib/registry-polaris"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "kitex_polaris"
+
+var _ polaris.MetricsRecorder = (*Metrics)(nil)
+
+// Metrics are the prometheus metrics of polaris registries and resolvers,
+// given to them with polaris.WithRegistryMetrics and polaris.WithResolverMetrics.
+type Metrics struct {
+	operations *prom.CounterVec
+	durations  *prom.HistogramVec
+	registered *prom.GaugeVec
+	resolved   *prom.GaugeVec
+	fallbacks  *prom.CounterVec
+}
+
+// NewMetrics creates the metrics and registers them to reg, like prometheus.DefaultRegisterer.
+// They are shared by the registries and resolvers given the same Metrics.
+func NewMetrics(reg prom.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		operations: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "operations_total",
+			Help:      "Number of polaris operations.",
+		}, []string{"namespace", "service", "operation", "result"}),
+		durations: prom.NewHistogramVec(prom.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "operation_duration_seconds",
+			Help:      "Latency of polaris operations.",
+			Buckets:   prom.DefBuckets,
+		}, []string{"namespace", "service", "operation", "result"}),
+		registered: prom.NewGaugeVec(prom.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "registered_instances",
+			Help:      "Number of instances registered to polaris.",
+		}, []string{"namespace", "service"}),
+		resolved: prom.NewGaugeVec(prom.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "resolved_instances",
+			Help:      "Number of instances of the last resolution.",
+		}, []string{"namespace", "service"}),
+		fallbacks: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "static_fallbacks_total",
+			Help:      "Number of resolutions served by static instances.",
+		}, []string{"namespace", "service"}),
+	}
+	for _, c := range []prom.Collector{m.operations, m.durations, m.registered, m.resolved, m.fallbacks} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// ObserveOperation implements the polaris.MetricsRecorder interface.
+func (m *Metrics) ObserveOperation(namespace, service, operation string, duration time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	m.operations.WithLabelValues(namespace, service, operation, result).Inc()
+	m.durations.WithLabelValues(namespace, service, operation, result).Observe(duration.Seconds())
+}
+
+// AddRegistered implements the polaris.MetricsRecorder interface.
+func (m *Metrics) AddRegistered(namespace, service string, delta int) {
+	m.registered.WithLabelValues(namespace, service).Add(float64(delta))
+}
+
+// SetResolved implements the polaris.MetricsRecorder interface.
+func (m *Metrics) SetResolved(namespace, service string, n int) {
+	m.resolved.WithLabelValues(namespace, service).Set(float64(n))
+}
+
+// AddStaticFallback implements the polaris.MetricsRecorder interface.
+func (m *Metrics) AddStaticFallback(namespace, service string) {
+	m.fallbacks.WithLabelValues(namespace, service).Inc()
+}
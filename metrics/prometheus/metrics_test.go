@@ -0,0 +1,86 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package prometheus
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudwego/kitex/pkg/registry"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"github.com/cloudwego/kitex/pkg/utils"
+	polaris "github.com/kitex-contrib/registry-polaris"
+	"github.com/kitex-contrib/registry-polaris/polaristest"
+	"github.com/polarismesh/polaris-go/pkg/model"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	namespace   = "default"
+	serviceName = "registry-test"
+)
+
+func TestMetrics(t *testing.T) {
+	reg := prom.NewRegistry()
+	m, err := NewMetrics(reg)
+	require.Nil(t, err)
+	_, err = NewMetrics(reg)
+	require.NotNil(t, err)
+
+	server := polaristest.NewServer()
+	rg := polaris.NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI(), polaris.WithRegistryMetrics(m))
+	rs := polaris.NewPolarisResolverByAPI(server.ProviderAPI(), server.ConsumerAPI(), polaris.WithResolverMetrics(m))
+	first := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+	second := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:7777")}
+
+	require.Nil(t, rg.Register(first))
+	require.Nil(t, rg.Register(first))
+	server.InjectError(polaristest.OpRegister, model.NewSDKError(model.ErrCodeNetworkError, nil, "network"), 1)
+	require.NotNil(t, rg.Register(second))
+	require.Nil(t, rg.Register(second))
+	require.Equal(t, 2.0, testutil.ToFloat64(m.registered.WithLabelValues(namespace, serviceName)))
+	require.Equal(t, 3.0, testutil.ToFloat64(m.operations.WithLabelValues(namespace, serviceName, polaris.OperationRegister, "success")))
+	require.Equal(t, 1.0, testutil.ToFloat64(m.operations.WithLabelValues(namespace, serviceName, polaris.OperationRegister, "error")))
+
+	desc := rs.Target(context.TODO(), rpcinfo.NewEndpointInfo(serviceName, "", nil, nil))
+	_, err = rs.Resolve(context.TODO(), desc)
+	require.Nil(t, err)
+	require.Equal(t, 2.0, testutil.ToFloat64(m.resolved.WithLabelValues(namespace, serviceName)))
+	require.Equal(t, 1.0, testutil.ToFloat64(m.operations.WithLabelValues(namespace, serviceName, polaris.OperationGetInstances, "success")))
+
+	require.Nil(t, rg.Deregister(first))
+	require.Nil(t, rg.Deregister(second))
+	require.Equal(t, 0.0, testutil.ToFloat64(m.registered.WithLabelValues(namespace, serviceName)))
+	require.Equal(t, 2.0, testutil.ToFloat64(m.operations.WithLabelValues(namespace, serviceName, polaris.OperationDeregister, "success")))
+	require.Equal(t, 4, testutil.CollectAndCount(m.durations))
+}
+
+func TestStaticFallbackMetrics(t *testing.T) {
+	m, err := NewMetrics(prom.NewRegistry())
+	require.Nil(t, err)
+	server := polaristest.NewServer()
+	rs := polaris.NewPolarisResolverByAPI(server.ProviderAPI(), server.ConsumerAPI(), polaris.WithResolverMetrics(m),
+		polaris.WithStaticFallback(polaris.StaticFallbackConfig{
+			Instances: map[string][]polaris.StaticInstance{namespace + ":" + serviceName: {{Address: "10.0.0.1:8888"}}},
+		}))
+
+	_, err = rs.Resolve(context.TODO(), namespace+":"+serviceName)
+	require.Nil(t, err)
+	require.Equal(t, 1.0, testutil.ToFloat64(m.fallbacks.WithLabelValues(namespace, serviceName)))
+}
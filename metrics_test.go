@@ -0,0 +1,118 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/registry"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"github.com/cloudwego/kitex/pkg/utils"
+	"github.com/kitex-contrib/registry-polaris/polaristest"
+	"github.com/polarismesh/polaris-go/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+// recordMetrics is a MetricsRecorder keeping, per joined labels, the recorded values.
+type recordMetrics struct {
+	lock       sync.Mutex
+	operations map[string]int
+	registered map[string]int
+	resolved   map[string]int
+	fallbacks  map[string]int
+}
+
+func newRecordMetrics() *recordMetrics {
+	return &recordMetrics{
+		operations: make(map[string]int),
+		registered: make(map[string]int),
+		resolved:   make(map[string]int),
+		fallbacks:  make(map[string]int),
+	}
+}
+
+func labels(values ...string) string {
+	return strings.Join(values, "/")
+}
+
+func (m *recordMetrics) ObserveOperation(namespace, service, operation string, duration time.Duration, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	m.operations[labels(namespace, service, operation, result)]++
+}
+
+func (m *recordMetrics) AddRegistered(namespace, service string, delta int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.registered[labels(namespace, service)] += delta
+}
+
+func (m *recordMetrics) SetResolved(namespace, service string, n int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.resolved[labels(namespace, service)] = n
+}
+
+func (m *recordMetrics) AddStaticFallback(namespace, service string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.fallbacks[labels(namespace, service)]++
+}
+
+// get returns the value of values recorded in metric.
+func (m *recordMetrics) get(metric map[string]int, values ...string) int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return metric[labels(values...)]
+}
+
+func TestMetrics(t *testing.T) {
+	m := newRecordMetrics()
+	server := polaristest.NewServer()
+	rg := NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI(), WithRegistryMetrics(m))
+	rs := NewPolarisResolverByAPI(server.ProviderAPI(), server.ConsumerAPI(), WithResolverMetrics(m))
+	first := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+	second := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:7777")}
+
+	require.Nil(t, rg.Register(first))
+	require.Nil(t, rg.Register(first))
+	server.InjectError(polaristest.OpRegister, model.NewSDKError(model.ErrCodeNetworkError, nil, "network"), 1)
+	require.NotNil(t, rg.Register(second))
+	require.Nil(t, rg.Register(second))
+	require.Equal(t, 2, m.get(m.registered, polarisDefaultNamespace, serviceName))
+	require.Equal(t, 3, m.get(m.operations, polarisDefaultNamespace, serviceName, OperationRegister, "success"))
+	require.Equal(t, 1, m.get(m.operations, polarisDefaultNamespace, serviceName, OperationRegister, "error"))
+
+	desc := rs.Target(context.TODO(), rpcinfo.NewEndpointInfo(serviceName, "", nil, nil))
+	_, err := rs.Resolve(context.TODO(), desc)
+	require.Nil(t, err)
+	require.Equal(t, 2, m.get(m.resolved, polarisDefaultNamespace, serviceName))
+	require.Equal(t, 1, m.get(m.operations, polarisDefaultNamespace, serviceName, OperationGetInstances, "success"))
+
+	require.Nil(t, rg.Deregister(first))
+	require.Nil(t, rg.Deregister(second))
+	require.Equal(t, 0, m.get(m.registered, polarisDefaultNamespace, serviceName))
+	require.Equal(t, 2, m.get(m.operations, polarisDefaultNamespace, serviceName, OperationDeregister, "success"))
+}
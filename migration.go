@@ -0,0 +1,209 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/discovery"
+	"github.com/cloudwego/kitex/pkg/registry"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+)
+
+const (
+	// RegistryTag is the tag holding the name of the registry a migration resolver discovered an instance in,
+	// "Polaris" or the name of the legacy resolver.
+	RegistryTag = "registry"
+
+	// migrationDescSeparator joins the descriptions of the polaris and the legacy resolvers.
+	migrationDescSeparator = "||"
+)
+
+// legacyWatchInterval is the interval between two resolutions of a legacy resolver without Watcher, that of
+// the Kitex resolver cache refreshes.
+var legacyWatchInterval = 5 * time.Second
+
+// migrationRegistry registers servers to polaris and to the registry being migrated from.
+type migrationRegistry struct {
+	polaris registry.Registry
+	legacy  registry.Registry
+	opts    *migrationRegistryOptions
+}
+
+// NewMigrationRegistry creates a registry registering servers to both polaris and legacy,
+// like an etcd or nacos registry, so that services can be migrated one by one.
+// A server is registered to both or to none: when one registration fails the other is rolled back.
+func NewMigrationRegistry(polaris registry.Registry, legacy registry.Registry, opts ...MigrationRegistryOption) registry.Registry {
+	return &migrationRegistry{polaris: polaris, legacy: legacy, opts: newMigrationRegistryOptions(opts)}
+}
+
+// Register implements the registry.Registry interface.
+func (m *migrationRegistry) Register(info *registry.Info) error {
+	return m.RegisterContext(context.Background(), info)
+}
+
+// RegisterContext implements the ContextRegistry interface, ctx only bounds the registries implementing it.
+func (m *migrationRegistry) RegisterContext(ctx context.Context, info *registry.Info) error {
+	if err := registerContext(ctx, m.legacy, info); err != nil {
+		return fmt.Errorf("fail to register to the legacy registry: %w", err)
+	}
+	if err := registerContext(ctx, m.polaris, info); err != nil {
+		if rollbackErr := m.legacy.Deregister(info); rollbackErr != nil {
+			m.opts.logger.Error("fail to roll back legacy registration", "addr", info.Addr, "err", rollbackErr)
+		}
+		return fmt.Errorf("fail to register to polaris: %w", err)
+	}
+	return nil
+}
+
+// Deregister implements the registry.Registry interface, the first failure is returned.
+func (m *migrationRegistry) Deregister(info *registry.Info) error {
+	return m.DeregisterContext(context.Background(), info)
+}
+
+// DeregisterContext implements the ContextRegistry interface, ctx only bounds the registries implementing it.
+func (m *migrationRegistry) DeregisterContext(ctx context.Context, info *registry.Info) error {
+	polarisErr := deregisterContext(ctx, m.polaris, info)
+	legacyErr := deregisterContext(ctx, m.legacy, info)
+	if polarisErr != nil {
+		return fmt.Errorf("fail to deregister from polaris: %w", polarisErr)
+	}
+	if legacyErr != nil {
+		return fmt.Errorf("fail to deregister from the legacy registry: %w", legacyErr)
+	}
+	return nil
+}
+
+// migrationResolver discovers services in polaris and in the registry being migrated from.
+type migrationResolver struct {
+	policy  MergePolicy
+	polaris Resolver
+	legacy  discovery.Resolver
+	watched *mergedWatch
+	// legacyInterval is the interval between two resolutions of a legacy resolver without Watcher.
+	legacyInterval time.Duration
+}
+
+// NewMigrationResolver creates a resolver merging the instances of polaris and legacy according to policy,
+// polaris being the local one for MergePreferLocal. Instances are tagged with RegistryTag.
+// The changes of legacy are watched when it implements Resolver, otherwise it is resolved periodically.
+func NewMigrationResolver(policy MergePolicy, polaris Resolver, legacy discovery.Resolver) Resolver {
+	return &migrationResolver{
+		policy:         policy,
+		polaris:        polaris,
+		legacy:         legacy,
+		watched:        newMergedWatch(policy),
+		legacyInterval: legacyWatchInterval,
+	}
+}
+
+// Target implements the Resolver interface, the description holds those of both resolvers.
+func (m *migrationResolver) Target(ctx context.Context, target rpcinfo.EndpointInfo) string {
+	return m.polaris.Target(ctx, target) + migrationDescSeparator + m.legacy.Target(ctx, target)
+}
+
+// splitDesc returns the descriptions of the polaris and the legacy resolvers.
+func (m *migrationResolver) splitDesc(desc string) (string, string) {
+	parts := strings.SplitN(desc, migrationDescSeparator, 2)
+	if len(parts) < 2 {
+		return desc, desc
+	}
+	return parts[0], parts[1]
+}
+
+// Resolve implements the Resolver interface.
+func (m *migrationResolver) Resolve(ctx context.Context, desc string) (discovery.Result, error) {
+	results := m.resolveRegistries(ctx, desc)
+	instances := mergeResults(m.policy, results)
+	if len(instances) == 0 {
+		return discovery.Result{}, fmt.Errorf("no instance remains for %s, polaris: %v, %s: %v",
+			desc, results[0].err, m.legacy.Name(), results[1].err)
+	}
+	return discovery.Result{
+		Cacheable: true,
+		CacheKey:  desc,
+		Instances: instances,
+	}, nil
+}
+
+// resolveRegistries resolves desc in polaris and in the legacy registry, in that order.
+func (m *migrationResolver) resolveRegistries(ctx context.Context, desc string) []clusterResult {
+	polarisDesc, legacyDesc := m.splitDesc(desc)
+	polarisResult, polarisErr := m.polaris.Resolve(ctx, polarisDesc)
+	legacyResult, legacyErr := m.legacy.Resolve(ctx, legacyDesc)
+	return []clusterResult{
+		{instances: tagInstances(polarisResult.Instances, RegistryTag, m.polaris.Name()), err: polarisErr},
+		{instances: tagInstances(legacyResult.Instances, RegistryTag, m.legacy.Name()), err: legacyErr},
+	}
+}
+
+// Watcher implements the Resolver interface. It waits for a change in polaris or in the legacy registry,
+// and returns the difference of the merged instances, changes hidden by the merge policy are skipped.
+func (m *migrationResolver) Watcher(ctx context.Context, desc string) (discovery.Change, error) {
+	polarisDesc, legacyDesc := m.splitDesc(desc)
+	watchPolaris := func(ctx context.Context) error {
+		if _, err := m.polaris.Watcher(ctx, polarisDesc); err != nil {
+			return fmt.Errorf("polaris: %w", err)
+		}
+		return nil
+	}
+	watchLegacy := func(ctx context.Context) error {
+		if legacy, ok := m.legacy.(Resolver); ok {
+			if _, err := legacy.Watcher(ctx, legacyDesc); err != nil {
+				return fmt.Errorf("%s: %w", m.legacy.Name(), err)
+			}
+			return nil
+		}
+		timer := time.NewTimer(m.legacyInterval)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+		return nil
+	}
+	return m.watched.next(ctx, desc, func(ctx context.Context) error {
+		return firstChange(ctx, watchPolaris, watchLegacy)
+	}, func(ctx context.Context) []clusterResult {
+		return m.resolveRegistries(ctx, desc)
+	}, m.Diff)
+}
+
+// Diff implements the Resolver interface.
+func (m *migrationResolver) Diff(cacheKey string, prev, next discovery.Result) (discovery.Change, bool) {
+	return diffResults(cacheKey, prev, next, func(ins discovery.Instance) (instanceState, bool) {
+		return m.instanceState(cacheKey, ins)
+	})
+}
+
+// instanceState implements the instanceStater interface, the polaris resolver knows the states.
+func (m *migrationResolver) instanceState(desc string, ins discovery.Instance) (instanceState, bool) {
+	tagged, ok := ins.(*taggedInstance)
+	if !ok || tagged.value != m.polaris.Name() {
+		return instanceState{}, false
+	}
+	polarisDesc, _ := m.splitDesc(desc)
+	return resolverInstanceState(m.polaris, polarisDesc, tagged.Instance)
+}
+
+// Name implements the Resolver interface.
+func (m *migrationResolver) Name() string {
+	return "PolarisMigration"
+}
@@ -0,0 +1,198 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/discovery"
+	"github.com/cloudwego/kitex/pkg/registry"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"github.com/cloudwego/kitex/pkg/utils"
+	"github.com/kitex-contrib/registry-polaris/polaristest"
+	"github.com/polarismesh/polaris-go/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryRegistry is a legacy registry and resolver keeping instances in memory.
+type memoryRegistry struct {
+	lock      sync.Mutex
+	instances map[string][]string
+	fail      error
+	// deregisterFail is returned by Deregister.
+	deregisterFail error
+}
+
+func (m *memoryRegistry) Register(info *registry.Info) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.fail != nil {
+		return m.fail
+	}
+	m.instances[info.ServiceName] = append(m.instances[info.ServiceName], info.Addr.String())
+	return nil
+}
+
+func (m *memoryRegistry) Deregister(info *registry.Info) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.deregisterFail != nil {
+		return m.deregisterFail
+	}
+	addrs := m.instances[info.ServiceName]
+	for i, addr := range addrs {
+		if addr == info.Addr.String() {
+			m.instances[info.ServiceName] = append(addrs[:i], addrs[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("not registered")
+}
+
+func (m *memoryRegistry) Target(ctx context.Context, target rpcinfo.EndpointInfo) string {
+	return target.ServiceName()
+}
+
+func (m *memoryRegistry) Resolve(ctx context.Context, desc string) (discovery.Result, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var instances []discovery.Instance
+	for _, addr := range m.instances[desc] {
+		instances = append(instances, discovery.NewInstance("tcp", addr, 10, nil))
+	}
+	return discovery.Result{Cacheable: true, CacheKey: desc, Instances: instances}, nil
+}
+
+func (m *memoryRegistry) Diff(cacheKey string, prev, next discovery.Result) (discovery.Change, bool) {
+	return discovery.DefaultDiff(cacheKey, prev, next)
+}
+
+func (m *memoryRegistry) Name() string {
+	return "memory"
+}
+
+func TestMigrationRegistry(t *testing.T) {
+	server := polaristest.NewServer()
+	legacy := &memoryRegistry{instances: make(map[string][]string)}
+	rg := NewMigrationRegistry(NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI()), legacy)
+	info := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+
+	require.Nil(t, rg.Register(info))
+	require.Len(t, server.Instances(polarisDefaultNamespace, serviceName), 1)
+	require.Equal(t, []string{"127.0.0.1:6666"}, legacy.instances[serviceName])
+	require.Nil(t, rg.Deregister(info))
+	require.Empty(t, server.Instances(polarisDefaultNamespace, serviceName))
+	require.Empty(t, legacy.instances[serviceName])
+
+	// the legacy registration is rolled back when polaris fails.
+	server.InjectError(polaristest.OpRegister, model.NewSDKError(model.ErrCodeNetworkError, nil, "network"), 1)
+	require.NotNil(t, rg.Register(info))
+	require.Empty(t, legacy.instances[serviceName])
+
+	legacy.fail = errors.New("unavailable")
+	require.NotNil(t, rg.Register(info))
+	require.Empty(t, server.Instances(polarisDefaultNamespace, serviceName))
+}
+
+func TestMigrationRegistryLogger(t *testing.T) {
+	server := polaristest.NewServer()
+	logger := &recordLogger{}
+	legacy := &memoryRegistry{instances: make(map[string][]string), deregisterFail: errors.New("unavailable")}
+	rg := NewMigrationRegistry(NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI()), legacy,
+		WithMigrationLogger(logger))
+	info := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+
+	server.InjectError(polaristest.OpRegister, model.NewSDKError(model.ErrCodeNetworkError, nil, "network"), 1)
+	require.NotNil(t, rg.Register(info))
+	require.Equal(t, []logEntry{{
+		level:  "error",
+		msg:    "fail to roll back legacy registration",
+		fields: []interface{}{"addr", info.Addr, "err", legacy.deregisterFail},
+	}}, logger.entries)
+}
+
+func TestMigrationResolver(t *testing.T) {
+	server := polaristest.NewServer()
+	legacy := &memoryRegistry{instances: make(map[string][]string)}
+	polarisRg := NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI())
+	polarisRs := NewPolarisResolverByAPI(server.ProviderAPI(), server.ConsumerAPI())
+	require.Nil(t, legacy.Register(&registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "10.0.0.1:6666")}))
+
+	resolve := func(policy MergePolicy) map[string]string {
+		rs := NewMigrationResolver(policy, polarisRs, legacy)
+		desc := rs.Target(context.TODO(), rpcinfo.NewEndpointInfo(serviceName, "", nil, nil))
+		result, err := rs.Resolve(context.TODO(), desc)
+		require.Nil(t, err)
+		addrs := make(map[string]string)
+		for _, ins := range result.Instances {
+			addrs[ins.Address().String()], _ = ins.Tag(RegistryTag)
+		}
+		return addrs
+	}
+
+	// the service has not been migrated yet.
+	require.Equal(t, map[string]string{"10.0.0.1:6666": "memory"}, resolve(MergePreferLocal))
+
+	info := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+	require.Nil(t, polarisRg.Register(info))
+	defer polarisRg.Deregister(info)
+	require.Equal(t, map[string]string{"127.0.0.1:6666": "Polaris"}, resolve(MergePreferLocal))
+	require.Equal(t, map[string]string{"127.0.0.1:6666": "Polaris", "10.0.0.1:6666": "memory"}, resolve(MergeUnion))
+}
+
+func TestMigrationWatcher(t *testing.T) {
+	defer func(interval time.Duration) { legacyWatchInterval = interval }(legacyWatchInterval)
+	legacyWatchInterval = 10 * time.Millisecond
+	server := polaristest.NewServer()
+	legacy := &memoryRegistry{instances: make(map[string][]string)}
+	polarisRg := NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI())
+	rs := NewMigrationResolver(MergeFailover, NewPolarisResolverByAPI(server.ProviderAPI(), server.ConsumerAPI()), legacy)
+	register := func(host string) {
+		require.Nil(t, legacy.Register(&registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", host+":6666")}))
+	}
+	register("10.0.0.1")
+	info := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+	require.Nil(t, polarisRg.Register(info))
+	desc := rs.Target(context.TODO(), rpcinfo.NewEndpointInfo(serviceName, "", nil, nil))
+	watch := func(timeout time.Duration) discovery.Change {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		change, err := rs.Watcher(ctx, desc)
+		require.Nil(t, err)
+		return change
+	}
+	// the first call starts watching.
+	require.Equal(t, discovery.Change{}, watch(50*time.Millisecond))
+
+	// the legacy instances are hidden while polaris has some.
+	register("10.0.0.2")
+	require.Equal(t, discovery.Change{}, watch(50*time.Millisecond))
+	require.Nil(t, polarisRg.Deregister(info))
+	change := watch(time.Second)
+	require.Equal(t, []string{"10.0.0.1:6666", "10.0.0.2:6666"}, addresses(change.Added))
+	require.Equal(t, []string{"127.0.0.1:6666"}, addresses(change.Removed))
+
+	register("10.0.0.3")
+	change = watch(time.Second)
+	require.Equal(t, []string{"10.0.0.3:6666"}, addresses(change.Added))
+	registry, _ := change.Added[0].Tag(RegistryTag)
+	require.Equal(t, "memory", registry)
+}
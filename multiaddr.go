@@ -0,0 +1,67 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/cloudwego/kitex/pkg/registry"
+	"github.com/cloudwego/kitex/pkg/utils"
+)
+
+// AdditionalAddrsTag is the registry.Info tag listing, comma separated, the
+// addresses a server listens on besides registry.Info.Addr, like "10.0.0.2:8888,[fd00::2]:8888".
+const AdditionalAddrsTag = "additional_addrs"
+
+// expandInfo returns one registry.Info per address of the server, registry.Info.Addr first.
+func (svr *polarisRegistry) expandInfo(info *registry.Info) ([]*registry.Info, error) {
+	// the options are shared by concurrent registrations, they are not appended to.
+	addrs := append([]string(nil), svr.opts.additionalAddrs...)
+	if tag, ok := info.Tags[AdditionalAddrsTag]; ok {
+		for _, addr := range strings.Split(tag, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+	// the addresses are compared once resolved, an unspecified host like ":8888" standing for the local IP.
+	_, key, err := createDeregisterParam(info, svr.opts.localIP)
+	if err != nil {
+		return nil, err
+	}
+	infos := []*registry.Info{info}
+	seen := map[string]bool{key: true}
+	for _, addr := range addrs {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return nil, fmt.Errorf("invalid additional addr %q, cause %v", addr, err)
+		}
+		extra := *info
+		extra.Addr = utils.NewNetAddr(info.Addr.Network(), addr)
+		_, key, err := createDeregisterParam(&extra, svr.opts.localIP)
+		if err != nil {
+			return nil, fmt.Errorf("invalid additional addr %q, cause %v", addr, err)
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		infos = append(infos, &extra)
+	}
+	return infos, nil
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/cloudwego/kitex/pkg/registry"
+	"github.com/cloudwego/kitex/pkg/utils"
+	"github.com/kitex-contrib/registry-polaris/polaristest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandInfo(t *testing.T) {
+	svr := &polarisRegistry{opts: newRegistryOptions([]RegistryOption{WithAdditionalAddrs("10.0.0.3:8888")})}
+	info := &registry.Info{
+		ServiceName: serviceName,
+		Addr:        utils.NewNetAddr("tcp", "10.0.0.1:8888"),
+		Tags:        map[string]string{AdditionalAddrsTag: "10.0.0.2:8888, [fd00::2]:8888,10.0.0.1:8888"},
+	}
+	infos, err := svr.expandInfo(info)
+	require.Nil(t, err)
+	var addrs []string
+	for _, ins := range infos {
+		require.Equal(t, serviceName, ins.ServiceName)
+		addrs = append(addrs, ins.Addr.String())
+	}
+	require.Equal(t, []string{"10.0.0.1:8888", "10.0.0.3:8888", "10.0.0.2:8888", "[fd00::2]:8888"}, addrs)
+
+	info.Tags[AdditionalAddrsTag] = "10.0.0.2"
+	_, err = svr.expandInfo(info)
+	require.NotNil(t, err)
+}
+
+func TestExpandInfoConcurrently(t *testing.T) {
+	// the additional addrs of the options have room to grow.
+	svr := &polarisRegistry{opts: newRegistryOptions([]RegistryOption{
+		WithAdditionalAddrs("10.0.0.3:8888"), WithAdditionalAddrs("10.0.0.4:8888"), WithAdditionalAddrs("10.0.0.5:8888"),
+	})}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		tag := fmt.Sprintf("10.0.1.%d:8888", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			infos, err := svr.expandInfo(&registry.Info{
+				ServiceName: serviceName,
+				Addr:        utils.NewNetAddr("tcp", "10.0.0.1:8888"),
+				Tags:        map[string]string{AdditionalAddrsTag: tag},
+			})
+			require.Nil(t, err)
+			require.Len(t, infos, 5)
+			require.Equal(t, tag, infos[4].Addr.String())
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, []string{"10.0.0.3:8888", "10.0.0.4:8888", "10.0.0.5:8888"}, svr.opts.additionalAddrs)
+}
+
+func TestAdditionalAddrsNotRegistered(t *testing.T) {
+	req, _, err := createRegisterParam(&registry.Info{
+		ServiceName: serviceName,
+		Addr:        utils.NewNetAddr("tcp", "10.0.0.1:8888"),
+		Tags:        map[string]string{AdditionalAddrsTag: "10.0.0.2:8888", "env": "test"},
+	}, GetLocalIPv4Address)
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"env": "test"}, req.Metadata)
+}
+
+func TestAdditionalAddrsUnspecified(t *testing.T) {
+	server := polaristest.NewServer()
+	localIP := AddressSelectorFunc(func() (string, error) { return "10.0.0.1", nil })
+	rg := NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI(), WithAddressSelector(localIP))
+	// the unspecified hosts stand for the local IP, that of Addr.
+	info := &registry.Info{
+		ServiceName: serviceName,
+		Addr:        utils.NewNetAddr("tcp", "10.0.0.1:8888"),
+		Tags:        map[string]string{AdditionalAddrsTag: ":8888,0.0.0.0:8888,10.0.0.2:8888"},
+	}
+	infos, err := rg.(*polarisRegistry).expandInfo(info)
+	require.Nil(t, err)
+	require.Len(t, infos, 2)
+
+	require.Nil(t, rg.Register(info))
+	require.Len(t, server.Instances(polarisDefaultNamespace, serviceName), 2)
+	require.Nil(t, rg.Deregister(info))
+	require.Empty(t, server.Instances(polarisDefaultNamespace, serviceName))
+}
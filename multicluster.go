@@ -0,0 +1,320 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/registry"
+	"github.com/polarismesh/polaris-go/api"
+)
+
+// RegistryCluster is a polaris cluster of a multi-cluster registry.
+type RegistryCluster struct {
+	Name     string
+	Registry Registry
+}
+
+// NewRegistryCluster creates the cluster name registered to through sdkCtx.
+func NewRegistryCluster(name string, sdkCtx api.SDKContext, opts ...RegistryOption) RegistryCluster {
+	return RegistryCluster{Name: name, Registry: NewPolarisRegistryByContext(sdkCtx, opts...)}
+}
+
+// defaultClusterRetryInterval is how often failed cluster registrations are retried by default.
+const defaultClusterRetryInterval = 10 * time.Second
+
+// ClusterStatus is the registration status of a cluster of a multi-cluster registry.
+type ClusterStatus struct {
+	Name string
+	// Registered is the number of instances registered to the cluster.
+	Registered int
+	// HeartbeatFailures is the number of failed heartbeats of the instances, when the cluster
+	// registry reports them like those created by NewPolarisRegistry and its variants.
+	HeartbeatFailures int
+	// LastError is the error of the last failed operation, heartbeats included,
+	// nil when the last operation succeeded.
+	LastError   error
+	LastErrorAt time.Time
+}
+
+// MultiClusterRegistry registers servers to several polaris clusters at once, like
+// the old and the new one during a migration.
+type MultiClusterRegistry interface {
+	Registry
+
+	// Status returns the status of every cluster, in the order they were given.
+	Status() []ClusterStatus
+}
+
+type multiClusterRegistry struct {
+	clusters []RegistryCluster
+	opts     *multiClusterOptions
+
+	lock   sync.Mutex
+	status []ClusterStatus
+	// registered holds, per instance, the clusters it is registered to.
+	registered map[string]*clusterInstance
+}
+
+// clusterInstance is an instance of a multi-cluster registry, guarded by multiClusterRegistry.lock.
+type clusterInstance struct {
+	// registered tells, per cluster, whether the instance is registered to it.
+	registered []bool
+	// cancel stops the retries of the failed registrations, done is closed once they stopped.
+	// Both are nil when no retry runs.
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewMultiClusterRegistry creates a registry fanning registrations out to clusters.
+// A failing cluster does not affect the others: Register only fails when no cluster succeeds,
+// the registration to the failing clusters is then retried in the background, and instances
+// are only deregistered from the clusters they were registered to.
+func NewMultiClusterRegistry(clusters []RegistryCluster, opts ...MultiClusterOption) MultiClusterRegistry {
+	status := make([]ClusterStatus, len(clusters))
+	for i, cluster := range clusters {
+		status[i].Name = cluster.Name
+	}
+	m := &multiClusterRegistry{
+		clusters:   clusters,
+		opts:       newMultiClusterOptions(opts),
+		status:     status,
+		registered: make(map[string]*clusterInstance),
+	}
+	for i, cluster := range clusters {
+		if r, ok := cluster.Registry.(observableRegistry); ok {
+			r.addObserver(m.clusterObserver(i))
+		}
+	}
+	return m
+}
+
+// clusterObserver records the background failures of the registry of cluster i.
+func (m *multiClusterRegistry) clusterObserver(i int) RegistryObserver {
+	return RegistryObserverFunc(func(event RegistryEvent) {
+		switch {
+		case event.Type == EventHeartbeatFailed:
+			m.lock.Lock()
+			m.status[i].HeartbeatFailures++
+			m.lock.Unlock()
+			m.record(i, event.Err)
+		case event.Type == EventReregistered && event.Err != nil:
+			m.record(i, event.Err)
+		}
+	})
+}
+
+// Register implements the Registry interface.
+func (m *multiClusterRegistry) Register(info *registry.Info) error {
+	return m.RegisterContext(context.Background(), info)
+}
+
+// RegisterContext implements the ContextRegistry interface.
+func (m *multiClusterRegistry) RegisterContext(ctx context.Context, info *registry.Info) error {
+	if err := validateInfo(info); err != nil {
+		return err
+	}
+	key := multiClusterKey(info)
+	errs := make([]string, 0, len(m.clusters))
+	registered := make([]bool, len(m.clusters))
+	for i, cluster := range m.clusters {
+		err := registerContext(ctx, cluster.Registry, info)
+		m.record(i, err)
+		if err != nil {
+			m.opts.logger.Error("fail to register to cluster", "instance", key, "cluster", cluster.Name, "err", err)
+			errs = append(errs, fmt.Sprintf("%s: %v", cluster.Name, err))
+			continue
+		}
+		registered[i] = true
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	ins := m.registered[key]
+	if len(errs) == len(m.clusters) {
+		if ins == nil {
+			return fmt.Errorf("fail to register %s to any cluster: %s", key, strings.Join(errs, "; "))
+		}
+		return nil
+	}
+	if ins == nil {
+		ins = &clusterInstance{registered: make([]bool, len(m.clusters))}
+		m.registered[key] = ins
+	}
+	for i := range registered {
+		if registered[i] && !ins.registered[i] {
+			ins.registered[i] = true
+			m.status[i].Registered++
+		}
+	}
+	if len(errs) > 0 && ins.cancel == nil {
+		retryCtx, cancel := context.WithCancel(context.Background())
+		ins.cancel, ins.done = cancel, make(chan struct{})
+		go m.retryRegister(retryCtx, key, info, ins)
+	}
+	return nil
+}
+
+// retryRegister registers info to the clusters it is not registered to, until it is registered
+// to every cluster or ctx is done.
+func (m *multiClusterRegistry) retryRegister(ctx context.Context, key string, info *registry.Info, ins *clusterInstance) {
+	defer close(ins.done)
+	ticker := time.NewTicker(m.opts.retryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		pending := 0
+		for i, cluster := range m.clusters {
+			m.lock.Lock()
+			registered := ins.registered[i]
+			m.lock.Unlock()
+			if registered {
+				continue
+			}
+			err := registerContext(ctx, cluster.Registry, info)
+			m.record(i, err)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				m.opts.logger.Warn("fail to retry registering to cluster", "instance", key, "cluster", cluster.Name, "err", err)
+				pending++
+				continue
+			}
+			// a registration completing while ctx is cancelled is recorded, so that it is deregistered.
+			m.lock.Lock()
+			ins.registered[i] = true
+			m.status[i].Registered++
+			m.lock.Unlock()
+		}
+		if pending == 0 {
+			m.lock.Lock()
+			ins.cancel, ins.done = nil, nil
+			m.lock.Unlock()
+			return
+		}
+	}
+}
+
+// Deregister implements the Registry interface.
+func (m *multiClusterRegistry) Deregister(info *registry.Info) error {
+	return m.DeregisterContext(context.Background(), info)
+}
+
+// DeregisterContext implements the ContextRegistry interface.
+func (m *multiClusterRegistry) DeregisterContext(ctx context.Context, info *registry.Info) error {
+	if err := validateInfo(info); err != nil {
+		return err
+	}
+	key := multiClusterKey(info)
+	m.lock.Lock()
+	ins, ok := m.registered[key]
+	var cancel context.CancelFunc
+	var done chan struct{}
+	if ok {
+		cancel, done = ins.cancel, ins.done
+	}
+	m.lock.Unlock()
+	if !ok {
+		return fmt.Errorf("instance{%s} has not registered", key)
+	}
+	if cancel != nil {
+		// the retries are over before deregistering, so that they do not register the instance again.
+		cancel()
+		<-done
+	}
+	m.lock.Lock()
+	ins.cancel, ins.done = nil, nil
+	registered := append([]bool(nil), ins.registered...)
+	m.lock.Unlock()
+
+	var errs []string
+	remaining := make([]bool, len(m.clusters))
+	for i, cluster := range m.clusters {
+		if !registered[i] {
+			continue
+		}
+		err := deregisterContext(ctx, cluster.Registry, info)
+		m.record(i, err)
+		if err != nil {
+			m.opts.logger.Error("fail to deregister from cluster", "instance", key, "cluster", cluster.Name, "err", err)
+			errs = append(errs, fmt.Sprintf("%s: %v", cluster.Name, err))
+			remaining[i] = true
+			continue
+		}
+		m.lock.Lock()
+		m.status[i].Registered--
+		m.lock.Unlock()
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if len(errs) == 0 {
+		delete(m.registered, key)
+		return nil
+	}
+	ins.registered = remaining
+	return fmt.Errorf("fail to deregister %s: %s", key, strings.Join(errs, "; "))
+}
+
+// doHeartbeat sends the heartbeats of ins to every cluster until ctx is done.
+func (m *multiClusterRegistry) doHeartbeat(ctx context.Context, ins *api.InstanceRegisterRequest) {
+	var wg sync.WaitGroup
+	for _, cluster := range m.clusters {
+		wg.Add(1)
+		go func(r Registry) {
+			defer wg.Done()
+			r.doHeartbeat(ctx, ins)
+		}(cluster.Registry)
+	}
+	wg.Wait()
+}
+
+// Status implements the MultiClusterRegistry interface.
+func (m *multiClusterRegistry) Status() []ClusterStatus {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	status := make([]ClusterStatus, len(m.status))
+	copy(status, m.status)
+	return status
+}
+
+// record updates the status of cluster i with the result of an operation.
+func (m *multiClusterRegistry) record(i int, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.status[i].LastError = err
+	if err != nil {
+		m.status[i].LastErrorAt = time.Now()
+	}
+}
+
+func multiClusterKey(info *registry.Info) string {
+	namespace, ok := info.Tags["namespace"]
+	if !ok {
+		namespace = polarisDefaultNamespace
+	}
+	return namespace + ":" + info.ServiceName + ":" + info.Addr.String()
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/registry"
+	"github.com/cloudwego/kitex/pkg/utils"
+	"github.com/kitex-contrib/registry-polaris/polaristest"
+	"github.com/polarismesh/polaris-go/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiClusterRegistry(t *testing.T) {
+	old, current := polaristest.NewServer(), polaristest.NewServer()
+	rg := NewMultiClusterRegistry([]RegistryCluster{
+		{Name: "old", Registry: NewPolarisRegistryByAPI(old.ProviderAPI(), old.ConsumerAPI())},
+		{Name: "new", Registry: NewPolarisRegistryByAPI(current.ProviderAPI(), current.ConsumerAPI())},
+	})
+	first := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+	second := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:7777")}
+
+	require.Nil(t, rg.Register(first))
+	require.Len(t, old.Instances(polarisDefaultNamespace, serviceName), 1)
+	require.Len(t, current.Instances(polarisDefaultNamespace, serviceName), 1)
+
+	// the old cluster fails, the new one keeps working.
+	old.InjectError(polaristest.OpRegister, model.NewSDKError(model.ErrCodeNetworkError, nil, "network"), 1)
+	require.Nil(t, rg.Register(second))
+	require.Len(t, old.Instances(polarisDefaultNamespace, serviceName), 1)
+	require.Len(t, current.Instances(polarisDefaultNamespace, serviceName), 2)
+	status := rg.Status()
+	require.Equal(t, "old", status[0].Name)
+	require.Equal(t, 1, status[0].Registered)
+	require.NotNil(t, status[0].LastError)
+	require.Equal(t, 2, status[1].Registered)
+	require.Nil(t, status[1].LastError)
+
+	// second is only deregistered from the new cluster.
+	require.Nil(t, rg.Deregister(second))
+	require.Nil(t, rg.Deregister(first))
+	require.Empty(t, old.Instances(polarisDefaultNamespace, serviceName))
+	require.Empty(t, current.Instances(polarisDefaultNamespace, serviceName))
+	status = rg.Status()
+	require.Equal(t, 0, status[0].Registered)
+	require.Nil(t, status[0].LastError)
+	require.Equal(t, 0, status[1].Registered)
+	require.NotNil(t, rg.Deregister(first))
+
+	old.InjectError(polaristest.OpRegister, model.NewSDKError(model.ErrCodeNetworkError, nil, "network"), 1)
+	current.InjectError(polaristest.OpRegister, model.NewSDKError(model.ErrCodeNetworkError, nil, "network"), 1)
+	require.NotNil(t, rg.Register(first))
+}
+
+func TestMultiClusterRetry(t *testing.T) {
+	old, current := polaristest.NewServer(), polaristest.NewServer()
+	logger := &recordLogger{}
+	rg := NewMultiClusterRegistry([]RegistryCluster{
+		{Name: "old", Registry: NewPolarisRegistryByAPI(old.ProviderAPI(), old.ConsumerAPI())},
+		{Name: "new", Registry: NewPolarisRegistryByAPI(current.ProviderAPI(), current.ConsumerAPI())},
+	}, WithClusterRetryInterval(time.Millisecond), WithMultiClusterLogger(logger))
+	info := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+
+	// the old cluster fails twice, the registration is retried until it succeeds.
+	old.InjectError(polaristest.OpRegister, model.NewSDKError(model.ErrCodeNetworkError, nil, "network"), 2)
+	require.Nil(t, rg.Register(info))
+	require.Empty(t, old.Instances(polarisDefaultNamespace, serviceName))
+	require.Eventually(t, func() bool {
+		return len(old.Instances(polarisDefaultNamespace, serviceName)) == 1
+	}, time.Second, time.Millisecond)
+	require.Eventually(t, func() bool { return rg.Status()[0].Registered == 1 }, time.Second, time.Millisecond)
+	require.NotEmpty(t, logger.entries)
+
+	require.Nil(t, rg.Deregister(info))
+	require.Empty(t, old.Instances(polarisDefaultNamespace, serviceName))
+	require.Empty(t, current.Instances(polarisDefaultNamespace, serviceName))
+
+	// the retries stop once the instance is deregistered.
+	old.InjectError(polaristest.OpRegister, model.NewSDKError(model.ErrCodeNetworkError, nil, "network"), 0)
+	require.Nil(t, rg.Register(info))
+	require.Nil(t, rg.Deregister(info))
+	calls := old.Calls(polaristest.OpRegister)
+	time.Sleep(10 * time.Millisecond)
+	require.Equal(t, calls, old.Calls(polaristest.OpRegister))
+	require.Equal(t, 0, rg.Status()[0].Registered)
+}
+
+func TestMultiClusterHeartbeatStatus(t *testing.T) {
+	formerHeartbeatTime := heartbeatTime
+	heartbeatTime = time.Millisecond
+	defer func() { heartbeatTime = formerHeartbeatTime }()
+
+	old, current := polaristest.NewServer(), polaristest.NewServer()
+	rg := NewMultiClusterRegistry([]RegistryCluster{
+		{Name: "old", Registry: NewPolarisRegistryByAPI(old.ProviderAPI(), old.ConsumerAPI())},
+		{Name: "new", Registry: NewPolarisRegistryByAPI(current.ProviderAPI(), current.ConsumerAPI())},
+	})
+	info := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+	require.Nil(t, rg.Register(info))
+	defer rg.Deregister(info)
+
+	old.InjectError(polaristest.OpHeartbeat, model.NewSDKError(model.ErrCodeNetworkError, nil, "network"), 1)
+	require.Eventually(t, func() bool {
+		status := rg.Status()[0]
+		return status.HeartbeatFailures == 1 && status.LastError != nil
+	}, time.Second, time.Millisecond)
+	require.Zero(t, rg.Status()[1].HeartbeatFailures)
+}
@@ -0,0 +1,280 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import "time"
+
+// RegistryOption customizes the behavior of a polaris registry.
+type RegistryOption func(o *registryOptions)
+
+type registryOptions struct {
+	warmup     *WarmupConfig
+	readiness  *ReadinessConfig
+	infoWeight bool
+
+	registerRetry   *RetryPolicy
+	deregisterRetry *RetryPolicy
+
+	reconcile *ReconcileConfig
+
+	additionalAddrs []string
+
+	ipPreference    IPPreference
+	addressSelector AddressSelector
+	// localIP returns the address registered for servers listening on an unspecified host.
+	localIP func() (string, error)
+
+	metrics *metrics
+	tracer  *tracer
+	logger  Logger
+
+	observers []RegistryObserver
+}
+
+func newRegistryOptions(opts []RegistryOption) *registryOptions {
+	o := &registryOptions{logger: globalLogger{}}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.addressSelector == nil {
+		o.addressSelector = PreferenceAddressSelector(o.ipPreference)
+	}
+	o.localIP = o.addressSelector.Select
+	return o
+}
+
+// WithWarmup enables weight warm-up for newly registered instances.
+// registry.Info.WarmUp, when set, overrides cfg.Duration for that instance.
+func WithWarmup(cfg WarmupConfig) RegistryOption {
+	return func(o *registryOptions) {
+		cfg.fillDefaults()
+		o.warmup = &cfg
+	}
+}
+
+// WithInfoWeight registers registry.Info.Weight as the polaris weight of the instances.
+// Kitex defaults the weight to 10 while polaris defaults it to 100, so the weight is
+// left to polaris by default.
+func WithInfoWeight() RegistryOption {
+	return func(o *registryOptions) {
+		o.infoWeight = true
+	}
+}
+
+// WithReadinessCheck delays registration until cfg.Check passes.
+func WithReadinessCheck(cfg ReadinessConfig) RegistryOption {
+	return func(o *registryOptions) {
+		cfg.fillDefaults()
+		o.readiness = &cfg
+	}
+}
+
+// WithRegisterRetry retries failed registrations according to policy.
+func WithRegisterRetry(policy RetryPolicy) RegistryOption {
+	return func(o *registryOptions) {
+		policy.fillDefaults()
+		o.registerRetry = &policy
+	}
+}
+
+// WithDeregisterRetry retries failed deregistrations according to policy.
+func WithDeregisterRetry(policy RetryPolicy) RegistryOption {
+	return func(o *registryOptions) {
+		policy.fillDefaults()
+		o.deregisterRetry = &policy
+	}
+}
+
+// WithReconcile periodically checks registered instances against polaris and repairs drift.
+func WithReconcile(cfg ReconcileConfig) RegistryOption {
+	return func(o *registryOptions) {
+		cfg.fillDefaults()
+		o.reconcile = &cfg
+	}
+}
+
+// WithAdditionalAddrs registers addrs, in host:port form, along with registry.Info.Addr.
+// They are added to the addresses listed in the AdditionalAddrsTag tag.
+func WithAdditionalAddrs(addrs ...string) RegistryOption {
+	return func(o *registryOptions) {
+		o.additionalAddrs = append(o.additionalAddrs, addrs...)
+	}
+}
+
+// WithIPPreference sets the IP family of the local address registered for
+// servers listening on an unspecified host, PreferIPv4 by default.
+// It has no effect when WithAddressSelector is used.
+func WithIPPreference(pref IPPreference) RegistryOption {
+	return func(o *registryOptions) {
+		o.ipPreference = pref
+	}
+}
+
+// WithAddressSelector sets how the local address registered for servers
+// listening on an unspecified host is selected.
+func WithAddressSelector(selector AddressSelector) RegistryOption {
+	return func(o *registryOptions) {
+		o.addressSelector = selector
+	}
+}
+
+// WithRegistryMetrics records the polaris operations and the registered instances of the registry to m.
+func WithRegistryMetrics(m MetricsRecorder) RegistryOption {
+	return func(o *registryOptions) {
+		o.metrics = newMetrics(m)
+	}
+}
+
+// WithRegistryTracing creates spans, from t, around the polaris calls of the registry.
+func WithRegistryTracing(t Tracer) RegistryOption {
+	return func(o *registryOptions) {
+		o.tracer = newTracer(t)
+	}
+}
+
+// WithRegistryLogger sets the logger of the registry, the one set by SetLogger by default.
+func WithRegistryLogger(logger Logger) RegistryOption {
+	return func(o *registryOptions) {
+		o.logger = logger
+	}
+}
+
+// WithRegistryObserver adds an observer of the lifecycle events of the instances of the registry.
+func WithRegistryObserver(observer RegistryObserver) RegistryOption {
+	return func(o *registryOptions) {
+		o.observers = append(o.observers, observer)
+	}
+}
+
+// MultiClusterOption customizes the behavior of a multi-cluster registry.
+type MultiClusterOption func(o *multiClusterOptions)
+
+type multiClusterOptions struct {
+	retryInterval time.Duration
+	logger        Logger
+}
+
+func newMultiClusterOptions(opts []MultiClusterOption) *multiClusterOptions {
+	o := &multiClusterOptions{retryInterval: defaultClusterRetryInterval, logger: globalLogger{}}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithClusterRetryInterval sets how often the registration of an instance to the clusters
+// it failed to register to is retried, 10s by default.
+func WithClusterRetryInterval(interval time.Duration) MultiClusterOption {
+	return func(o *multiClusterOptions) {
+		if interval > 0 {
+			o.retryInterval = interval
+		}
+	}
+}
+
+// WithMultiClusterLogger sets the logger of the multi-cluster registry, the one set by SetLogger by default.
+func WithMultiClusterLogger(logger Logger) MultiClusterOption {
+	return func(o *multiClusterOptions) {
+		o.logger = logger
+	}
+}
+
+// MigrationRegistryOption customizes the behavior of a migration registry.
+type MigrationRegistryOption func(o *migrationRegistryOptions)
+
+type migrationRegistryOptions struct {
+	logger Logger
+}
+
+func newMigrationRegistryOptions(opts []MigrationRegistryOption) *migrationRegistryOptions {
+	o := &migrationRegistryOptions{logger: globalLogger{}}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithMigrationLogger sets the logger of the migration registry, the one set by SetLogger by default.
+func WithMigrationLogger(logger Logger) MigrationRegistryOption {
+	return func(o *migrationRegistryOptions) {
+		o.logger = logger
+	}
+}
+
+// ResolverOption customizes the behavior of a polaris resolver.
+type ResolverOption func(o *resolverOptions)
+
+type resolverOptions struct {
+	snapshot       *SnapshotConfig
+	staticFallback *StaticFallbackConfig
+	cache          ResolveCacheConfig
+
+	metrics *metrics
+	tracer  *tracer
+	logger  Logger
+}
+
+func newResolverOptions(opts []ResolverOption) *resolverOptions {
+	o := &resolverOptions{logger: globalLogger{}}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithSnapshot persists resolved instances and falls back to them when polaris is unreachable.
+func WithSnapshot(cfg SnapshotConfig) ResolverOption {
+	return func(o *resolverOptions) {
+		cfg.fillDefaults()
+		o.snapshot = &cfg
+	}
+}
+
+// WithStaticFallback resolves descriptions to fixed instances when polaris fails or returns no instance.
+func WithStaticFallback(cfg StaticFallbackConfig) ResolverOption {
+	return func(o *resolverOptions) {
+		o.staticFallback = &cfg
+	}
+}
+
+// WithResolverMetrics records the polaris operations and the resolved instances of the resolver to m.
+func WithResolverMetrics(m MetricsRecorder) ResolverOption {
+	return func(o *resolverOptions) {
+		o.metrics = newMetrics(m)
+	}
+}
+
+// WithResolverTracing creates spans, from t, around the polaris calls of the resolver.
+func WithResolverTracing(t Tracer) ResolverOption {
+	return func(o *resolverOptions) {
+		o.tracer = newTracer(t)
+	}
+}
+
+// WithResolverLogger sets the logger of the resolver, the one set by SetLogger by default.
+func WithResolverLogger(logger Logger) ResolverOption {
+	return func(o *resolverOptions) {
+		o.logger = logger
+	}
+}
+
+// WithResolveCache configures the cache of the resolved instances.
+func WithResolveCache(cfg ResolveCacheConfig) ResolverOption {
+	return func(o *resolverOptions) {
+		o.cache = cfg
+	}
+}
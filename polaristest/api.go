@@ -0,0 +1,165 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaristest
+
+import (
+	"sync"
+
+	"github.com/polarismesh/polaris-go/api"
+	"github.com/polarismesh/polaris-go/pkg/model"
+)
+
+var (
+	_ api.ProviderAPI = (*providerAPI)(nil)
+	_ api.ConsumerAPI = (*consumerAPI)(nil)
+)
+
+func errNotSupported(method string) error {
+	return model.NewSDKError(model.ErrCodeAPIInvalidArgument, nil, "%s is not supported by polaristest", method)
+}
+
+// providerAPI is a polaris ProviderAPI backed by a Server.
+type providerAPI struct {
+	server *Server
+}
+
+// SDKContext implements the api.SDKOwner interface, the fake has no SDKContext.
+func (p *providerAPI) SDKContext() api.SDKContext {
+	return nil
+}
+
+// Register implements the api.ProviderAPI interface.
+func (p *providerAPI) Register(instance *api.InstanceRegisterRequest) (*model.InstanceRegisterResponse, error) {
+	return p.server.register(&instance.InstanceRegisterRequest)
+}
+
+// Deregister implements the api.ProviderAPI interface.
+func (p *providerAPI) Deregister(instance *api.InstanceDeRegisterRequest) error {
+	return p.server.deregister(&instance.InstanceDeRegisterRequest)
+}
+
+// Heartbeat implements the api.ProviderAPI interface.
+func (p *providerAPI) Heartbeat(instance *api.InstanceHeartbeatRequest) error {
+	return p.server.heartbeat(&instance.InstanceHeartbeatRequest)
+}
+
+// Destroy implements the api.ProviderAPI interface.
+func (p *providerAPI) Destroy() {}
+
+// consumerAPI is a polaris ConsumerAPI backed by a Server.
+type consumerAPI struct {
+	server *Server
+
+	// like polaris-go, the watches of a service share one channel until Destroy.
+	lock    sync.Mutex
+	watches map[model.ServiceKey]chan model.SubScribeEvent
+}
+
+// SDKContext implements the api.SDKOwner interface, the fake has no SDKContext.
+func (c *consumerAPI) SDKContext() api.SDKContext {
+	return nil
+}
+
+// GetOneInstance implements the api.ConsumerAPI interface, it returns the first available instance.
+func (c *consumerAPI) GetOneInstance(req *api.GetOneInstanceRequest) (*model.OneInstanceResponse, error) {
+	c.server.lock.Lock()
+	defer c.server.lock.Unlock()
+	resp, err := c.server.instances(OpGetInstances, req.Namespace, req.Service, isAvailable)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Instances) == 0 {
+		return nil, model.NewSDKError(model.ErrCodeAPIInstanceNotFound, nil, "no instance available for %s:%s",
+			req.Namespace, req.Service)
+	}
+	resp.Instances = resp.Instances[:1]
+	return &model.OneInstanceResponse{InstancesResponse: *resp}, nil
+}
+
+// GetInstances implements the api.ConsumerAPI interface, it returns the healthy and not isolated instances.
+func (c *consumerAPI) GetInstances(req *api.GetInstancesRequest) (*model.InstancesResponse, error) {
+	c.server.lock.Lock()
+	defer c.server.lock.Unlock()
+	filter := isAvailable
+	if req.IncludeUnhealthyInstances {
+		filter = func(ins *Instance) bool { return !ins.Isolated && ins.Weight > 0 }
+	}
+	return c.server.instances(OpGetInstances, req.Namespace, req.Service, filter)
+}
+
+// GetAllInstances implements the api.ConsumerAPI interface.
+func (c *consumerAPI) GetAllInstances(req *api.GetAllInstancesRequest) (*model.InstancesResponse, error) {
+	c.server.lock.Lock()
+	defer c.server.lock.Unlock()
+	return c.server.instances(OpGetAllInstances, req.Namespace, req.Service, func(*Instance) bool { return true })
+}
+
+// GetRouteRule implements the api.ConsumerAPI interface, it is not supported.
+func (c *consumerAPI) GetRouteRule(*api.GetServiceRuleRequest) (*model.ServiceRuleResponse, error) {
+	return nil, errNotSupported("GetRouteRule")
+}
+
+// UpdateServiceCallResult implements the api.ConsumerAPI interface, results are ignored.
+func (c *consumerAPI) UpdateServiceCallResult(*api.ServiceCallResult) error {
+	return nil
+}
+
+// Destroy implements the api.ConsumerAPI interface, it cancels the watches of the consumer.
+func (c *consumerAPI) Destroy() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for key, ch := range c.watches {
+		c.server.unwatch(key, ch)
+		delete(c.watches, key)
+	}
+}
+
+// WatchService implements the api.ConsumerAPI interface.
+func (c *consumerAPI) WatchService(req *api.WatchServiceRequest) (*model.WatchServiceResponse, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	resp, ch, err := c.server.watch(req.Key, c.watches[req.Key])
+	if err != nil {
+		return nil, err
+	}
+	c.watches[req.Key] = ch
+	return resp, nil
+}
+
+// GetMeshConfig implements the api.ConsumerAPI interface, it is not supported.
+func (c *consumerAPI) GetMeshConfig(*api.GetMeshConfigRequest) (*model.MeshConfigResponse, error) {
+	return nil, errNotSupported("GetMeshConfig")
+}
+
+// GetMesh implements the api.ConsumerAPI interface, it is not supported.
+func (c *consumerAPI) GetMesh(*api.GetMeshRequest) (*model.MeshResponse, error) {
+	return nil, errNotSupported("GetMesh")
+}
+
+// GetServicesByBusiness implements the api.ConsumerAPI interface, it is not supported.
+func (c *consumerAPI) GetServicesByBusiness(*api.GetServicesRequest) (*model.ServicesResponse, error) {
+	return nil, errNotSupported("GetServicesByBusiness")
+}
+
+// InitCalleeService implements the api.ConsumerAPI interface, it is a no-op.
+func (c *consumerAPI) InitCalleeService(*api.InitCalleeServiceRequest) error {
+	return nil
+}
+
+func isAvailable(ins *Instance) bool {
+	return ins.Healthy && !ins.Isolated && ins.Weight > 0
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaristest
+
+import (
+	"testing"
+
+	"github.com/polarismesh/polaris-go/api"
+	"github.com/polarismesh/polaris-go/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchService(t *testing.T) {
+	server := NewServer()
+	provider := server.ProviderAPI()
+	register := &api.InstanceRegisterRequest{}
+	register.Namespace, register.Service, register.Host, register.Port = "default", "watched", "127.0.0.1", 6666
+	_, err := provider.Register(register)
+	require.Nil(t, err)
+	watchers := func() int {
+		server.lock.Lock()
+		defer server.lock.Unlock()
+		return len(server.services[model.ServiceKey{Namespace: "default", Service: "watched"}].watchers)
+	}
+
+	consumer := server.ConsumerAPI()
+	req := &api.WatchServiceRequest{}
+	req.Key = model.ServiceKey{Namespace: "default", Service: "watched"}
+	first, err := consumer.WatchService(req)
+	require.Nil(t, err)
+	second, err := consumer.WatchService(req)
+	require.Nil(t, err)
+	// the watches of a consumer share one channel.
+	require.Equal(t, first.EventChannel, second.EventChannel)
+	require.Equal(t, 1, watchers())
+
+	consumer.Destroy()
+	require.Zero(t, watchers())
+}
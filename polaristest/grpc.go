@@ -0,0 +1,422 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaristest
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/polarismesh/polaris-go/pkg/model"
+	namingpb "github.com/polarismesh/polaris-go/pkg/model/pb/v1"
+	"google.golang.org/grpc"
+)
+
+const (
+	defaultHealthCheckInterval = time.Second
+	discoverPushBufSize        = 64
+)
+
+// Fault describes how the gRPC server misbehaves for an operation.
+type Fault struct {
+	// Latency delays the response.
+	Latency time.Duration
+	// Code, when set, is returned without executing the request, like 500000 for a server exception.
+	Code uint32
+	// Drop reports success without executing the request, for heartbeats it simulates lost heartbeats.
+	// Dropped discover requests get no response at all.
+	Drop bool
+}
+
+// GRPCServer serves a Server over the polaris naming gRPC protocol, so that
+// the real polaris-go SDK can be pointed at it with global.serverConnector.addresses.
+// Instance changes are pushed to the discover streams that asked for the service,
+// and heartbeat TTLs expire in real time while the server runs.
+type GRPCServer struct {
+	store  *Server
+	server *grpc.Server
+
+	lock     sync.Mutex
+	listener net.Listener
+	faults   map[Op]Fault
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+var _ namingpb.PolarisGRPCServer = (*GRPCServer)(nil)
+
+// NewGRPCServer creates a gRPC server backed by store.
+func NewGRPCServer(store *Server) *GRPCServer {
+	return &GRPCServer{
+		store:  store,
+		faults: make(map[Op]Fault),
+		stop:   make(chan struct{}),
+	}
+}
+
+// Start listens on addr, like "127.0.0.1:0", and serves in the background.
+func (g *GRPCServer) Start(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	g.lock.Lock()
+	g.listener = listener
+	g.server = grpc.NewServer()
+	g.lock.Unlock()
+	namingpb.RegisterPolarisGRPCServer(g.server, g)
+	go g.server.Serve(listener)
+	go g.expireHeartbeats()
+	return nil
+}
+
+// Addr returns the address the server listens on.
+func (g *GRPCServer) Addr() string {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.listener == nil {
+		return ""
+	}
+	return g.listener.Addr().String()
+}
+
+// Stop closes the listener and every open stream, it may be called more than once.
+func (g *GRPCServer) Stop() {
+	g.stopOnce.Do(func() { close(g.stop) })
+	g.lock.Lock()
+	server := g.server
+	g.lock.Unlock()
+	if server != nil {
+		server.Stop()
+	}
+}
+
+// SetFault makes op misbehave as described by fault, the zero Fault restores normal behavior.
+// OpRegister, OpDeregister, OpHeartbeat and OpDiscover are supported.
+func (g *GRPCServer) SetFault(op Op, fault Fault) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if fault == (Fault{}) {
+		delete(g.faults, op)
+		return
+	}
+	g.faults[op] = fault
+}
+
+// fault sleeps for the latency of op and returns its fault.
+func (g *GRPCServer) fault(op Op) Fault {
+	g.lock.Lock()
+	fault := g.faults[op]
+	g.lock.Unlock()
+	if fault.Latency > 0 {
+		time.Sleep(fault.Latency)
+	}
+	return fault
+}
+
+// expireHeartbeats moves the store clock with the real one.
+func (g *GRPCServer) expireHeartbeats() {
+	ticker := time.NewTicker(defaultHealthCheckInterval)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-g.stop:
+			return
+		case now := <-ticker.C:
+			g.store.Advance(now.Sub(last))
+			last = now
+		}
+	}
+}
+
+// ReportClient implements the namingpb.PolarisGRPCServer interface.
+func (g *GRPCServer) ReportClient(ctx context.Context, req *namingpb.Client) (*namingpb.Response, error) {
+	return &namingpb.Response{
+		Code:   &wrappers.UInt32Value{Value: namingpb.ExecuteSuccess},
+		Info:   &wrappers.StringValue{Value: "execute success"},
+		Client: &namingpb.Client{Host: req.Host, Type: req.Type, Version: req.Version, Location: &namingpb.Location{}},
+	}, nil
+}
+
+// RegisterInstance implements the namingpb.PolarisGRPCServer interface.
+func (g *GRPCServer) RegisterInstance(ctx context.Context, req *namingpb.Instance) (*namingpb.Response, error) {
+	if resp := faultResponse(g.fault(OpRegister), req); resp != nil {
+		return resp, nil
+	}
+	registerReq := &model.InstanceRegisterRequest{
+		Service:   req.GetService().GetValue(),
+		Namespace: req.GetNamespace().GetValue(),
+		Host:      req.GetHost().GetValue(),
+		Port:      int(req.GetPort().GetValue()),
+		Metadata:  req.GetMetadata(),
+	}
+	if req.Protocol != nil {
+		registerReq.Protocol = &req.Protocol.Value
+	}
+	if req.Version != nil {
+		registerReq.Version = &req.Version.Value
+	}
+	if req.Weight != nil {
+		weight := int(req.Weight.Value)
+		registerReq.Weight = &weight
+	}
+	if req.Priority != nil {
+		priority := int(req.Priority.Value)
+		registerReq.Priority = &priority
+	}
+	if req.Healthy != nil {
+		registerReq.Healthy = &req.Healthy.Value
+	}
+	if req.Isolate != nil {
+		registerReq.Isolate = &req.Isolate.Value
+	}
+	if ttl := req.GetHealthCheck().GetHeartbeat().GetTtl(); ttl != nil {
+		value := int(ttl.Value)
+		registerReq.TTL = &value
+	}
+	resp, err := g.store.register(registerReq)
+	if err != nil {
+		return errorResponse(namingpb.ExecuteException, err.Error(), req), nil
+	}
+	code, info := namingpb.ExecuteSuccess, "execute success"
+	if resp.Existed {
+		code, info = namingpb.ExistedResource, "existed resource"
+	}
+	instance := *req
+	instance.Id = &wrappers.StringValue{Value: resp.InstanceID}
+	return &namingpb.Response{
+		Code:     &wrappers.UInt32Value{Value: code},
+		Info:     &wrappers.StringValue{Value: info},
+		Instance: &instance,
+	}, nil
+}
+
+// DeregisterInstance implements the namingpb.PolarisGRPCServer interface.
+func (g *GRPCServer) DeregisterInstance(ctx context.Context, req *namingpb.Instance) (*namingpb.Response, error) {
+	if resp := faultResponse(g.fault(OpDeregister), req); resp != nil {
+		return resp, nil
+	}
+	err := g.store.deregister(&model.InstanceDeRegisterRequest{
+		Service:   req.GetService().GetValue(),
+		Namespace: req.GetNamespace().GetValue(),
+		Host:      req.GetHost().GetValue(),
+		Port:      int(req.GetPort().GetValue()),
+	})
+	if err != nil {
+		return errorResponse(namingpb.ExecuteException, err.Error(), req), nil
+	}
+	return errorResponse(namingpb.ExecuteSuccess, "execute success", req), nil
+}
+
+// Heartbeat implements the namingpb.PolarisGRPCServer interface.
+func (g *GRPCServer) Heartbeat(ctx context.Context, req *namingpb.Instance) (*namingpb.Response, error) {
+	if resp := faultResponse(g.fault(OpHeartbeat), req); resp != nil {
+		return resp, nil
+	}
+	err := g.store.heartbeat(&model.InstanceHeartbeatRequest{
+		Service:   req.GetService().GetValue(),
+		Namespace: req.GetNamespace().GetValue(),
+		Host:      req.GetHost().GetValue(),
+		Port:      int(req.GetPort().GetValue()),
+	})
+	if err != nil {
+		return errorResponse(namingpb.NotFoundResource, err.Error(), req), nil
+	}
+	return errorResponse(namingpb.ExecuteSuccess, "execute success", req), nil
+}
+
+// Discover implements the namingpb.PolarisGRPCServer interface.
+func (g *GRPCServer) Discover(stream namingpb.PolarisGRPC_DiscoverServer) error {
+	requests := make(chan *namingpb.DiscoverRequest)
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			select {
+			case requests <- req:
+			case <-stream.Context().Done():
+				return
+			}
+		}
+	}()
+
+	changed := make(chan model.ServiceKey, discoverPushBufSize)
+	removeListener := g.store.addListener(func(key model.ServiceKey) {
+		select {
+		case changed <- key:
+		default:
+		}
+	})
+	defer removeListener()
+
+	watched := make(map[model.ServiceKey]*namingpb.Service)
+	for {
+		var req *namingpb.DiscoverRequest
+		select {
+		case err := <-recvErr:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case req = <-requests:
+			if req.Type == namingpb.DiscoverRequest_INSTANCE {
+				watched[serviceKey(req.Service)] = req.Service
+			}
+		case key := <-changed:
+			svc, ok := watched[key]
+			if !ok {
+				continue
+			}
+			req = &namingpb.DiscoverRequest{Type: namingpb.DiscoverRequest_INSTANCE, Service: svc}
+		}
+		fault := g.fault(OpDiscover)
+		if fault.Drop {
+			continue
+		}
+		if err := stream.Send(g.discover(req, fault)); err != nil {
+			return err
+		}
+	}
+}
+
+// discover builds the response of a discover request.
+func (g *GRPCServer) discover(req *namingpb.DiscoverRequest, fault Fault) *namingpb.DiscoverResponse {
+	resp := &namingpb.DiscoverResponse{
+		Type:    discoverResponseType(req.Type),
+		Service: req.Service,
+	}
+	if fault.Code != 0 {
+		resp.Code = &wrappers.UInt32Value{Value: fault.Code}
+		resp.Info = &wrappers.StringValue{Value: "injected fault"}
+		return resp
+	}
+	key := serviceKey(req.Service)
+	g.store.lock.Lock()
+	instances, err := g.store.instances(OpDiscover, key.Namespace, key.Service, func(*Instance) bool { return true })
+	g.store.lock.Unlock()
+	if err != nil {
+		resp.Code = &wrappers.UInt32Value{Value: namingpb.NotFoundResource}
+		resp.Info = &wrappers.StringValue{Value: err.Error()}
+		return resp
+	}
+	resp.Code = &wrappers.UInt32Value{Value: namingpb.ExecuteSuccess}
+	resp.Info = &wrappers.StringValue{Value: "execute success"}
+	resp.Service = &namingpb.Service{
+		Name:      &wrappers.StringValue{Value: key.Service},
+		Namespace: &wrappers.StringValue{Value: key.Namespace},
+		Revision:  &wrappers.StringValue{Value: instances.Revision},
+	}
+	switch req.Type {
+	case namingpb.DiscoverRequest_INSTANCE:
+		for _, ins := range instances.Instances {
+			resp.Instances = append(resp.Instances, instanceToProto(ins.(*Instance)))
+		}
+	case namingpb.DiscoverRequest_ROUTING:
+		resp.Routing = &namingpb.Routing{
+			Service:   resp.Service.Name,
+			Namespace: resp.Service.Namespace,
+			Revision:  resp.Service.Revision,
+		}
+	case namingpb.DiscoverRequest_RATE_LIMIT:
+		resp.RateLimit = &namingpb.RateLimit{Revision: resp.Service.Revision}
+	default:
+		resp.Code = &wrappers.UInt32Value{Value: namingpb.InvalidParameter}
+		resp.Info = &wrappers.StringValue{Value: "unsupported discover type " + req.Type.String()}
+	}
+	return resp
+}
+
+func faultResponse(fault Fault, req *namingpb.Instance) *namingpb.Response {
+	if fault.Code != 0 {
+		return errorResponse(fault.Code, "injected fault", req)
+	}
+	if fault.Drop {
+		return errorResponse(namingpb.ExecuteSuccess, "execute success", req)
+	}
+	return nil
+}
+
+func errorResponse(code uint32, info string, req *namingpb.Instance) *namingpb.Response {
+	return &namingpb.Response{
+		Code:     &wrappers.UInt32Value{Value: code},
+		Info:     &wrappers.StringValue{Value: info},
+		Instance: req,
+	}
+}
+
+func serviceKey(svc *namingpb.Service) model.ServiceKey {
+	return model.ServiceKey{
+		Namespace: svc.GetNamespace().GetValue(),
+		Service:   svc.GetName().GetValue(),
+	}
+}
+
+func discoverResponseType(t namingpb.DiscoverRequest_DiscoverRequestType) namingpb.DiscoverResponse_DiscoverResponseType {
+	switch t {
+	case namingpb.DiscoverRequest_INSTANCE:
+		return namingpb.DiscoverResponse_INSTANCE
+	case namingpb.DiscoverRequest_ROUTING:
+		return namingpb.DiscoverResponse_ROUTING
+	case namingpb.DiscoverRequest_RATE_LIMIT:
+		return namingpb.DiscoverResponse_RATE_LIMIT
+	case namingpb.DiscoverRequest_CLUSTER:
+		return namingpb.DiscoverResponse_CLUSTER
+	case namingpb.DiscoverRequest_MESH_CONFIG:
+		return namingpb.DiscoverResponse_MESH_CONFIG
+	case namingpb.DiscoverRequest_MESH:
+		return namingpb.DiscoverResponse_MESH
+	case namingpb.DiscoverRequest_SERVICES:
+		return namingpb.DiscoverResponse_SERVICES
+	}
+	return namingpb.DiscoverResponse_UNKNOWN
+}
+
+func instanceToProto(ins *Instance) *namingpb.Instance {
+	pbIns := &namingpb.Instance{
+		Id:                &wrappers.StringValue{Value: ins.ID},
+		Service:           &wrappers.StringValue{Value: ins.Service},
+		Namespace:         &wrappers.StringValue{Value: ins.Namespace},
+		Host:              &wrappers.StringValue{Value: ins.Host},
+		Port:              &wrappers.UInt32Value{Value: uint32(ins.Port)},
+		Protocol:          &wrappers.StringValue{Value: ins.Protocol},
+		Version:           &wrappers.StringValue{Value: ins.Version},
+		Priority:          &wrappers.UInt32Value{Value: ins.Priority},
+		Weight:            &wrappers.UInt32Value{Value: uint32(ins.Weight)},
+		EnableHealthCheck: &wrappers.BoolValue{Value: ins.TTL > 0},
+		Healthy:           &wrappers.BoolValue{Value: ins.Healthy},
+		Isolate:           &wrappers.BoolValue{Value: ins.Isolated},
+		Metadata:          ins.Metadata,
+		Revision:          &wrappers.StringValue{Value: ins.Revision},
+	}
+	if ins.TTL > 0 {
+		pbIns.HealthCheck = &namingpb.HealthCheck{
+			Type:      namingpb.HealthCheck_HEARTBEAT,
+			Heartbeat: &namingpb.HeartbeatHealthCheck{Ttl: &wrappers.UInt32Value{Value: uint32(ins.TTL)}},
+		}
+	}
+	return pbIns
+}
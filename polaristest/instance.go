@@ -0,0 +1,134 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaristest
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/polarismesh/polaris-go/pkg/model"
+)
+
+// Instance is an instance stored by the fake server, it implements model.Instance.
+// Instances handed out by the fake APIs are snapshots and never change.
+type Instance struct {
+	ID        string
+	Namespace string
+	Service   string
+	Host      string
+	Port      int
+	Protocol  string
+	Version   string
+	Weight    int
+	Priority  uint32
+	Metadata  map[string]string
+	Healthy   bool
+	Isolated  bool
+	// TTL is the heartbeat TTL in seconds, zero disables the heartbeat health check.
+	TTL      int
+	Revision string
+
+	lastHeartbeat time.Time
+}
+
+var _ model.Instance = (*Instance)(nil)
+
+// clone returns a snapshot of the instance.
+func (i *Instance) clone() *Instance {
+	c := *i
+	c.Metadata = make(map[string]string, len(i.Metadata))
+	for k, v := range i.Metadata {
+		c.Metadata[k] = v
+	}
+	return &c
+}
+
+// GetInstanceKey implements the model.Instance interface.
+func (i *Instance) GetInstanceKey() model.InstanceKey {
+	return model.InstanceKey{
+		ServiceKey: model.ServiceKey{Namespace: i.Namespace, Service: i.Service},
+		Host:       i.Host,
+		Port:       i.Port,
+	}
+}
+
+// GetNamespace implements the model.Instance interface.
+func (i *Instance) GetNamespace() string { return i.Namespace }
+
+// GetService implements the model.Instance interface.
+func (i *Instance) GetService() string { return i.Service }
+
+// GetId implements the model.Instance interface.
+func (i *Instance) GetId() string { return i.ID }
+
+// GetHost implements the model.Instance interface.
+func (i *Instance) GetHost() string { return i.Host }
+
+// GetPort implements the model.Instance interface.
+func (i *Instance) GetPort() uint32 { return uint32(i.Port) }
+
+// GetVpcId implements the model.Instance interface.
+func (i *Instance) GetVpcId() string { return "" }
+
+// GetProtocol implements the model.Instance interface.
+func (i *Instance) GetProtocol() string { return i.Protocol }
+
+// GetVersion implements the model.Instance interface.
+func (i *Instance) GetVersion() string { return i.Version }
+
+// GetWeight implements the model.Instance interface.
+func (i *Instance) GetWeight() int { return i.Weight }
+
+// GetPriority implements the model.Instance interface.
+func (i *Instance) GetPriority() uint32 { return i.Priority }
+
+// GetMetadata implements the model.Instance interface.
+func (i *Instance) GetMetadata() map[string]string { return i.Metadata }
+
+// GetLogicSet implements the model.Instance interface.
+func (i *Instance) GetLogicSet() string { return "" }
+
+// GetCircuitBreakerStatus implements the model.Instance interface.
+func (i *Instance) GetCircuitBreakerStatus() model.CircuitBreakerStatus { return nil }
+
+// IsHealthy implements the model.Instance interface.
+func (i *Instance) IsHealthy() bool { return i.Healthy }
+
+// IsIsolated implements the model.Instance interface.
+func (i *Instance) IsIsolated() bool { return i.Isolated }
+
+// IsEnableHealthCheck implements the model.Instance interface.
+func (i *Instance) IsEnableHealthCheck() bool { return i.TTL > 0 }
+
+// GetRegion implements the model.Instance interface.
+func (i *Instance) GetRegion() string { return "" }
+
+// GetZone implements the model.Instance interface.
+func (i *Instance) GetZone() string { return "" }
+
+// GetIDC implements the model.Instance interface.
+func (i *Instance) GetIDC() string { return "" }
+
+// GetCampus implements the model.Instance interface.
+func (i *Instance) GetCampus() string { return "" }
+
+// GetRevision implements the model.Instance interface.
+func (i *Instance) GetRevision() string { return i.Revision }
+
+func instanceAddr(host string, port int) string {
+	return host + "|" + strconv.Itoa(port)
+}
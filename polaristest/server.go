@@ -0,0 +1,420 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package polaristest provides an in-memory polaris naming service and fake
+// ProviderAPI and ConsumerAPI backed by it, so that registration and discovery
+// can be unit tested without a polaris deployment.
+//
+// The server has its own clock, heartbeat TTLs only expire when Advance is called.
+package polaristest
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/polarismesh/polaris-go/api"
+	"github.com/polarismesh/polaris-go/pkg/model"
+)
+
+const (
+	defaultWeight       = 100
+	watchChannelBufSize = 1024
+)
+
+// Op identifies an API call of the fake server, used to inject errors.
+type Op string
+
+// The operations of the fake server.
+const (
+	OpRegister        Op = "Register"
+	OpDeregister      Op = "Deregister"
+	OpHeartbeat       Op = "Heartbeat"
+	OpGetInstances    Op = "GetInstances"
+	OpGetAllInstances Op = "GetAllInstances"
+	OpWatchService    Op = "WatchService"
+	OpDiscover        Op = "Discover"
+)
+
+type service struct {
+	key       model.ServiceKey
+	instances map[string]*Instance
+	revision  int
+	watchers  []chan model.SubScribeEvent
+}
+
+type injectedError struct {
+	err   error
+	times int
+}
+
+// Server is an in-memory polaris naming service.
+type Server struct {
+	lock     sync.Mutex
+	now      time.Time
+	nextID   int
+	services map[model.ServiceKey]*service
+	errors   map[Op]*injectedError
+	calls    map[Op]int
+	// listeners are notified of every change of a service, they must not block.
+	listeners    map[int]func(key model.ServiceKey)
+	nextListener int
+}
+
+// NewServer creates an empty in-memory polaris naming service.
+func NewServer() *Server {
+	return &Server{
+		now:      time.Unix(0, 0),
+		services: make(map[model.ServiceKey]*service),
+		errors:   make(map[Op]*injectedError),
+		calls:    make(map[Op]int),
+
+		listeners: make(map[int]func(key model.ServiceKey)),
+	}
+}
+
+// ProviderAPI returns a polaris ProviderAPI backed by the server.
+func (s *Server) ProviderAPI() api.ProviderAPI {
+	return &providerAPI{server: s}
+}
+
+// ConsumerAPI returns a polaris ConsumerAPI backed by the server.
+func (s *Server) ConsumerAPI() api.ConsumerAPI {
+	return &consumerAPI{server: s, watches: make(map[model.ServiceKey]chan model.SubScribeEvent)}
+}
+
+// Now returns the current time of the server clock.
+func (s *Server) Now() time.Time {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.now
+}
+
+// Advance moves the server clock forward by d, instances whose heartbeat is
+// older than their TTL become unhealthy and watchers are notified.
+func (s *Server) Advance(d time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.now = s.now.Add(d)
+	for _, svc := range s.services {
+		var updates []model.OneInstanceUpdate
+		for _, ins := range svc.instances {
+			if !ins.Healthy || ins.TTL <= 0 {
+				continue
+			}
+			if s.now.Sub(ins.lastHeartbeat) > time.Duration(ins.TTL)*time.Second {
+				before := ins.clone()
+				ins.Healthy = false
+				s.bumpRevision(svc, ins)
+				updates = append(updates, model.OneInstanceUpdate{Before: before, After: ins.clone()})
+			}
+		}
+		if len(updates) > 0 {
+			s.notify(svc, &model.InstanceEvent{UpdateEvent: &model.InstanceUpdateEvent{UpdateList: updates}})
+		}
+	}
+}
+
+// InjectError makes the next times calls of op fail with err, times <= 0 means every call.
+func (s *Server) InjectError(op Op, err error, times int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err == nil {
+		delete(s.errors, op)
+		return
+	}
+	s.errors[op] = &injectedError{err: err, times: times}
+}
+
+// Calls returns how many times op was called, including failed calls.
+func (s *Server) Calls(op Op) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.calls[op]
+}
+
+// Instances returns a snapshot of every instance of the service, sorted by host and port.
+func (s *Server) Instances(namespace, serviceName string) []*Instance {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	svc := s.services[model.ServiceKey{Namespace: namespace, Service: serviceName}]
+	if svc == nil {
+		return nil
+	}
+	return sortedInstances(svc, func(*Instance) bool { return true })
+}
+
+// UpdateInstance applies update to the instance at host:port and notifies watchers,
+// it reports whether the instance exists. It can simulate operator actions such as isolation.
+func (s *Server) UpdateInstance(namespace, serviceName, host string, port int, update func(ins *Instance)) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	svc := s.services[model.ServiceKey{Namespace: namespace, Service: serviceName}]
+	if svc == nil {
+		return false
+	}
+	ins, ok := svc.instances[instanceAddr(host, port)]
+	if !ok {
+		return false
+	}
+	before := ins.clone()
+	update(ins)
+	s.bumpRevision(svc, ins)
+	s.notify(svc, &model.InstanceEvent{UpdateEvent: &model.InstanceUpdateEvent{
+		UpdateList: []model.OneInstanceUpdate{{Before: before, After: ins.clone()}},
+	}})
+	return true
+}
+
+// call records a call of op and returns the injected error, if any.
+// It must be called with s.lock held.
+func (s *Server) call(op Op) error {
+	s.calls[op]++
+	injected, ok := s.errors[op]
+	if !ok {
+		return nil
+	}
+	if injected.times > 0 {
+		injected.times--
+		if injected.times == 0 {
+			delete(s.errors, op)
+		}
+	}
+	return injected.err
+}
+
+func (s *Server) register(req *model.InstanceRegisterRequest) (*model.InstanceRegisterResponse, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call(OpRegister); err != nil {
+		return nil, err
+	}
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	key := model.ServiceKey{Namespace: req.Namespace, Service: req.Service}
+	svc, ok := s.services[key]
+	if !ok {
+		svc = &service{key: key, instances: make(map[string]*Instance)}
+		s.services[key] = svc
+	}
+	addr := instanceAddr(req.Host, req.Port)
+	ins, existed := svc.instances[addr]
+	var before *Instance
+	if existed {
+		before = ins.clone()
+	} else {
+		s.nextID++
+		ins = &Instance{
+			ID:        strconv.Itoa(s.nextID),
+			Namespace: req.Namespace,
+			Service:   req.Service,
+			Host:      req.Host,
+			Port:      req.Port,
+			Weight:    defaultWeight,
+			Healthy:   true,
+		}
+		svc.instances[addr] = ins
+	}
+	if req.Protocol != nil {
+		ins.Protocol = *req.Protocol
+	}
+	if req.Version != nil {
+		ins.Version = *req.Version
+	}
+	if req.Weight != nil {
+		ins.Weight = *req.Weight
+	}
+	if req.Priority != nil {
+		ins.Priority = uint32(*req.Priority)
+	}
+	if req.Metadata != nil {
+		ins.Metadata = make(map[string]string, len(req.Metadata))
+		for k, v := range req.Metadata {
+			ins.Metadata[k] = v
+		}
+	}
+	if req.Healthy != nil {
+		ins.Healthy = *req.Healthy
+	}
+	if req.Isolate != nil {
+		ins.Isolated = *req.Isolate
+	}
+	if req.TTL != nil {
+		ins.TTL = *req.TTL
+	}
+	ins.lastHeartbeat = s.now
+	s.bumpRevision(svc, ins)
+
+	event := &model.InstanceEvent{}
+	if existed {
+		event.UpdateEvent = &model.InstanceUpdateEvent{
+			UpdateList: []model.OneInstanceUpdate{{Before: before, After: ins.clone()}},
+		}
+	} else {
+		event.AddEvent = &model.InstanceAddEvent{Instances: []model.Instance{ins.clone()}}
+	}
+	s.notify(svc, event)
+	return &model.InstanceRegisterResponse{InstanceID: ins.ID, Existed: existed}, nil
+}
+
+func (s *Server) deregister(req *model.InstanceDeRegisterRequest) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call(OpDeregister); err != nil {
+		return err
+	}
+	svc := s.services[model.ServiceKey{Namespace: req.Namespace, Service: req.Service}]
+	if svc == nil {
+		return nil
+	}
+	addr := instanceAddr(req.Host, req.Port)
+	ins, ok := svc.instances[addr]
+	if !ok {
+		return nil
+	}
+	delete(svc.instances, addr)
+	svc.revision++
+	s.notify(svc, &model.InstanceEvent{DeleteEvent: &model.InstanceDeleteEvent{Instances: []model.Instance{ins.clone()}}})
+	return nil
+}
+
+func (s *Server) heartbeat(req *model.InstanceHeartbeatRequest) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call(OpHeartbeat); err != nil {
+		return err
+	}
+	svc := s.services[model.ServiceKey{Namespace: req.Namespace, Service: req.Service}]
+	var ins *Instance
+	if svc != nil {
+		ins = svc.instances[instanceAddr(req.Host, req.Port)]
+	}
+	if ins == nil {
+		return model.NewSDKError(model.ErrCodeServerUserError, nil, "instance %s:%d not found", req.Host, req.Port)
+	}
+	ins.lastHeartbeat = s.now
+	if !ins.Healthy {
+		before := ins.clone()
+		ins.Healthy = true
+		s.bumpRevision(svc, ins)
+		s.notify(svc, &model.InstanceEvent{UpdateEvent: &model.InstanceUpdateEvent{
+			UpdateList: []model.OneInstanceUpdate{{Before: before, After: ins.clone()}},
+		}})
+	}
+	return nil
+}
+
+// instances returns the instances of a service accepted by filter, it must be called with s.lock held.
+func (s *Server) instances(op Op, namespace, serviceName string, filter func(*Instance) bool) (*model.InstancesResponse, error) {
+	if err := s.call(op); err != nil {
+		return nil, err
+	}
+	svc := s.services[model.ServiceKey{Namespace: namespace, Service: serviceName}]
+	if svc == nil {
+		return nil, model.NewSDKError(model.ErrCodeServiceNotFound, nil, "service %s:%s not found", namespace, serviceName)
+	}
+	resp := &model.InstancesResponse{
+		ServiceInfo: model.ServiceInfo{Service: serviceName, Namespace: namespace},
+		Revision:    strconv.Itoa(svc.revision),
+	}
+	for _, ins := range sortedInstances(svc, filter) {
+		resp.Instances = append(resp.Instances, ins)
+		resp.TotalWeight += ins.Weight
+	}
+	return resp, nil
+}
+
+// watch returns the instances of key, and ch, created when nil, to which the changes of key are sent.
+func (s *Server) watch(key model.ServiceKey, ch chan model.SubScribeEvent) (*model.WatchServiceResponse, chan model.SubScribeEvent, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	resp, err := s.instances(OpWatchService, key.Namespace, key.Service, func(*Instance) bool { return true })
+	if err != nil {
+		return nil, nil, err
+	}
+	if ch == nil {
+		ch = make(chan model.SubScribeEvent, watchChannelBufSize)
+		svc := s.services[key]
+		svc.watchers = append(svc.watchers, ch)
+	}
+	return &model.WatchServiceResponse{EventChannel: ch, GetAllInstancesResp: resp}, ch, nil
+}
+
+// unwatch stops sending the changes of key to ch.
+func (s *Server) unwatch(key model.ServiceKey, ch chan model.SubScribeEvent) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	svc, ok := s.services[key]
+	if !ok {
+		return
+	}
+	for i, watcher := range svc.watchers {
+		if watcher == ch {
+			svc.watchers = append(svc.watchers[:i], svc.watchers[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *Server) bumpRevision(svc *service, ins *Instance) {
+	svc.revision++
+	ins.Revision = strconv.Itoa(svc.revision)
+}
+
+// notify sends event to the watchers of svc, events are dropped for watchers lagging by watchChannelBufSize.
+func (s *Server) notify(svc *service, event *model.InstanceEvent) {
+	for _, ch := range svc.watchers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+	for _, listener := range s.listeners {
+		listener(svc.key)
+	}
+}
+
+// addListener registers a non-blocking listener of service changes and returns its removal func.
+func (s *Server) addListener(listener func(key model.ServiceKey)) func() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	id := s.nextListener
+	s.nextListener++
+	s.listeners[id] = listener
+	return func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		delete(s.listeners, id)
+	}
+}
+
+func sortedInstances(svc *service, filter func(*Instance) bool) []*Instance {
+	instances := make([]*Instance, 0, len(svc.instances))
+	for _, ins := range svc.instances {
+		if filter(ins) {
+			instances = append(instances, ins.clone())
+		}
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		if instances[i].Host != instances[j].Host {
+			return instances[i].Host < instances[j].Host
+		}
+		return instances[i].Port < instances[j].Port
+	})
+	return instances
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"context"
+	"time"
+
+	perrors "github.com/pkg/errors"
+)
+
+const defaultReadinessRetryInterval = time.Second
+
+// ReadinessConfig gates registration on an application readiness check.
+//
+// Kitex calls Register while holding the server lock, so the check runs in the
+// background: Register returns immediately and the instance is registered to
+// polaris, and starts sending heartbeats, once Check passes.
+type ReadinessConfig struct {
+	// Check reports whether the server is ready to receive traffic.
+	Check func(ctx context.Context) error
+	// Timeout bounds the overall wait, the instance is not registered if it elapses.
+	// Zero means waiting until the instance is deregistered.
+	Timeout time.Duration
+	// RetryInterval is the pause between two failed checks, 1s by default.
+	RetryInterval time.Duration
+}
+
+func (c *ReadinessConfig) fillDefaults() {
+	if c.RetryInterval <= 0 {
+		c.RetryInterval = defaultReadinessRetryInterval
+	}
+}
+
+// wait blocks until Check passes, ctx is done or Timeout elapses.
+func (c *ReadinessConfig) wait(ctx context.Context, logger Logger) error {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+		err := c.Check(ctx)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return perrors.WithMessage(err, "readiness check not passed")
+		}
+		logger.Debug("readiness check not passed", "retry_in", c.RetryInterval, "err", err)
+		timer.Reset(c.RetryInterval)
+	}
+}
+
+// registerWhenReady registers the instance once the readiness check passes.
+func (svr *polarisRegistry) registerWhenReady(ctx context.Context, insHeartbeat *polarisHeartbeat,
+	warmupDuration time.Duration, targetWeight int) {
+	defer close(insHeartbeat.pending)
+	if err := svr.opts.readiness.wait(ctx, svr.opts.logger); err != nil {
+		if ctx.Err() != context.Canceled {
+			svr.opts.logger.Error("instance is not registered", "instance", insHeartbeat.instanceKey, "err", err)
+			svr.lock.Lock()
+			svr.removeInstance(insHeartbeat)
+			svr.lock.Unlock()
+			svr.notify(EventRegistered, insHeartbeat.instanceKey, insHeartbeat.request, err)
+		}
+		return
+	}
+	// the registration is not abandoned when ctx is cancelled, so that it is not left in polaris.
+	if err := svr.doRegister(context.Background(), ctx, insHeartbeat, warmupDuration, targetWeight); err != nil {
+		svr.opts.logger.Error("register fail after readiness check", "instance", insHeartbeat.instanceKey, "err", err)
+		svr.lock.Lock()
+		svr.removeInstance(insHeartbeat)
+		svr.lock.Unlock()
+		svr.notify(EventRegistered, insHeartbeat.instanceKey, insHeartbeat.request, err)
+		return
+	}
+
+	svr.lock.Lock()
+	cancelled := ctx.Err() != nil
+	if !cancelled {
+		insHeartbeat.registered = true
+		svr.opts.metrics.addRegistered(insHeartbeat.request.Namespace, insHeartbeat.request.Service, 1)
+	}
+	param := insHeartbeat.request
+	request := createDeregisterRequest(param)
+	svr.lock.Unlock()
+	if !cancelled {
+		svr.notify(EventRegistered, insHeartbeat.instanceKey, param, nil)
+		return
+	}
+	// Deregister ran while the instance was being registered and skipped polaris.
+	if err := svr.deregister(context.Background(), request); err != nil {
+		svr.opts.logger.Error("deregister fail", "instance", insHeartbeat.instanceKey, "err", err)
+	}
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/registry"
+	"github.com/cloudwego/kitex/pkg/utils"
+	"github.com/kitex-contrib/registry-polaris/polaristest"
+	"github.com/stretchr/testify/require"
+)
+
+// readiness returns a readiness check passing once ready is closed.
+func readiness(ready chan struct{}, timeout time.Duration) RegistryOption {
+	return WithReadinessCheck(ReadinessConfig{
+		Check: func(ctx context.Context) error {
+			select {
+			case <-ready:
+				return nil
+			default:
+				return errors.New("not ready")
+			}
+		},
+		Timeout:       timeout,
+		RetryInterval: time.Millisecond,
+	})
+}
+
+func TestRegistryReadinessCheck(t *testing.T) {
+	server := polaristest.NewServer()
+	ready := make(chan struct{})
+	rg := NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI(), readiness(ready, 0))
+	info := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+
+	require.Nil(t, rg.Register(info))
+	time.Sleep(10 * time.Millisecond)
+	require.Empty(t, server.Instances(polarisDefaultNamespace, serviceName))
+
+	close(ready)
+	require.Eventually(t, func() bool { return len(server.Instances(polarisDefaultNamespace, serviceName)) == 1 }, time.Second, time.Millisecond)
+	require.Nil(t, rg.Deregister(info))
+	require.Empty(t, server.Instances(polarisDefaultNamespace, serviceName))
+}
+
+func TestReadinessTimeout(t *testing.T) {
+	server := polaristest.NewServer()
+	rg := NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI(),
+		readiness(make(chan struct{}), 10*time.Millisecond)).(*polarisRegistry)
+	info := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+
+	require.Nil(t, rg.Register(info))
+	// the instance is forgotten once the check times out.
+	require.Eventually(t, func() bool {
+		rg.lock.RLock()
+		defer rg.lock.RUnlock()
+		return len(rg.registryIns) == 0
+	}, time.Second, time.Millisecond)
+	require.NotNil(t, rg.Deregister(info))
+	require.Empty(t, server.Instances(polarisDefaultNamespace, serviceName))
+}
+
+func TestDeregisterWhileRegistering(t *testing.T) {
+	server := polaristest.NewServer()
+	provider := &blockingProvider{
+		ProviderAPI: server.ProviderAPI(),
+		blocked:     make(chan time.Duration, 8),
+		unblock:     make(chan struct{}),
+	}
+	ready := make(chan struct{})
+	close(ready)
+	rg := NewPolarisRegistryByAPI(provider, server.ConsumerAPI(), readiness(ready, 0))
+	info := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+
+	require.Nil(t, rg.Register(info))
+	<-provider.blocked
+	done := make(chan error, 1)
+	go func() { done <- rg.Deregister(info) }()
+	select {
+	case <-done:
+		require.FailNow(t, "Deregister returned while the instance was being registered")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(provider.unblock)
+	require.Nil(t, <-done)
+	require.Empty(t, server.Instances(polarisDefaultNamespace, serviceName))
+}
+
+func TestReregisterWhileWaiting(t *testing.T) {
+	server := polaristest.NewServer()
+	ready := make(chan struct{})
+	rg := NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI(), readiness(ready, 0)).(*polarisRegistry)
+	info := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+
+	require.Nil(t, rg.Register(info))
+	rg.lock.RLock()
+	former := rg.registryIns[GetInstanceKey(polarisDefaultNamespace, serviceName, "127.0.0.1", "6666")]
+	rg.lock.RUnlock()
+	require.NotNil(t, former)
+	require.Nil(t, rg.Register(info))
+	// the former registration stops waiting.
+	select {
+	case <-former.pending:
+	case <-time.After(time.Second):
+		require.FailNow(t, "the former registration is still waiting")
+	}
+
+	close(ready)
+	require.Eventually(t, func() bool { return len(server.Instances(polarisDefaultNamespace, serviceName)) == 1 }, time.Second, time.Millisecond)
+	require.Nil(t, rg.Deregister(info))
+	require.Empty(t, server.Instances(polarisDefaultNamespace, serviceName))
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/polarismesh/polaris-go/api"
+	"github.com/polarismesh/polaris-go/pkg/model"
+)
+
+const defaultReconcileInterval = 30 * time.Second
+
+// ReconcileConfig configures the background check that registered instances
+// still exist in polaris with the desired weight and metadata.
+type ReconcileConfig struct {
+	// Interval is the pause between two checks of one instance, 30s by default.
+	Interval time.Duration
+	// KeepIsolated leaves alone the instances isolated in polaris, by an operator for example.
+	KeepIsolated bool
+}
+
+func (c *ReconcileConfig) fillDefaults() {
+	if c.Interval <= 0 {
+		c.Interval = defaultReconcileInterval
+	}
+}
+
+// doReconcile periodically repairs the drift between polaris and the desired state of the instance.
+func (svr *polarisRegistry) doReconcile(ctx context.Context, insHeartbeat *polarisHeartbeat) {
+	ticker := time.NewTicker(svr.opts.reconcile.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := svr.reconcile(ctx, insHeartbeat); err != nil && ctx.Err() == nil {
+				svr.opts.logger.Warn("fail to reconcile instance", "instance", insHeartbeat.instanceKey, "err", err)
+			}
+		}
+	}
+}
+
+// reconcile compares the instance in polaris with the desired state and re-registers it on drift.
+func (svr *polarisRegistry) reconcile(ctx context.Context, insHeartbeat *polarisHeartbeat) error {
+	svr.lock.RLock()
+	desired := insHeartbeat.request
+	svr.lock.RUnlock()
+
+	_, span := svr.opts.tracer.start(ctx, "GetAllInstances", desired.Namespace, desired.Service)
+	getAll := &api.GetAllInstancesRequest{
+		GetAllInstancesRequest: model.GetAllInstancesRequest{
+			Service:   desired.Service,
+			Namespace: desired.Namespace,
+			Timeout:   requestTimeout(ctx, nil),
+		},
+	}
+	var resp *model.InstancesResponse
+	err := callContext(ctx, func() (err error) {
+		resp, err = svr.consumer.GetAllInstances(getAll)
+		return err
+	})
+	if err == nil {
+		span.SetAttributes(attrInstanceCount.Int(len(resp.GetInstances())))
+	}
+	endSpan(span, err)
+	if err != nil {
+		return err
+	}
+	var actual model.Instance
+	for _, instance := range resp.GetInstances() {
+		if instance.GetHost() == desired.Host && int(instance.GetPort()) == desired.Port {
+			actual = instance
+			break
+		}
+	}
+	drift := instanceDrift(desired, actual, svr.opts.reconcile.KeepIsolated)
+	if len(drift) == 0 {
+		return nil
+	}
+
+	insHeartbeat.opLock.Lock()
+	if ctx.Err() != nil {
+		insHeartbeat.opLock.Unlock()
+		return nil
+	}
+	svr.opts.logger.Warn("instance drifted in polaris, registering it again",
+		"instance", insHeartbeat.instanceKey, "drift", strings.Join(drift, ","))
+	req := *desired
+	if actual != nil && actual.IsIsolated() && !svr.opts.reconcile.KeepIsolated {
+		req.SetIsolate(false)
+	}
+	_, err = svr.register(ctx, &req)
+	// the observers may deregister the instance, which takes opLock.
+	insHeartbeat.opLock.Unlock()
+	svr.notify(EventReregistered, insHeartbeat.instanceKey, &req, err)
+	return err
+}
+
+// instanceDrift lists the differences between the desired instance and the one found in polaris.
+func instanceDrift(desired *api.InstanceRegisterRequest, actual model.Instance, keepIsolated bool) []string {
+	if actual == nil {
+		return []string{"missing"}
+	}
+	var drift []string
+	if desired.Weight != nil && *desired.Weight != actual.GetWeight() {
+		drift = append(drift, fmt.Sprintf("weight %d, want %d", actual.GetWeight(), *desired.Weight))
+	}
+	if desired.Protocol != nil && *desired.Protocol != actual.GetProtocol() {
+		drift = append(drift, fmt.Sprintf("protocol %s, want %s", actual.GetProtocol(), *desired.Protocol))
+	}
+	metadata := actual.GetMetadata()
+	for k, v := range desired.Metadata {
+		if got, ok := metadata[k]; !ok || got != v {
+			drift = append(drift, fmt.Sprintf("metadata %s=%q, want %q", k, got, v))
+		}
+	}
+	if actual.IsIsolated() && !keepIsolated {
+		drift = append(drift, "isolated")
+	}
+	return drift
+}
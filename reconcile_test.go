@@ -0,0 +1,97 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/registry"
+	"github.com/cloudwego/kitex/pkg/utils"
+	"github.com/kitex-contrib/registry-polaris/polaristest"
+	"github.com/stretchr/testify/require"
+)
+
+// instanceAt returns the instance of the test service registered to server at host:port, nil when there is none.
+func instanceAt(server *polaristest.Server, host string, port int) *polaristest.Instance {
+	for _, ins := range server.Instances(polarisDefaultNamespace, serviceName) {
+		if ins.Host == host && ins.Port == port {
+			return ins
+		}
+	}
+	return nil
+}
+
+func TestRegistryReconcile(t *testing.T) {
+	server := polaristest.NewServer()
+	rg := NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI(),
+		WithInfoWeight(), WithReconcile(ReconcileConfig{Interval: time.Millisecond}))
+	info := &registry.Info{
+		ServiceName: serviceName,
+		Addr:        utils.NewNetAddr("tcp", "127.0.0.1:6666"),
+		Weight:      50,
+		Tags:        map[string]string{"env": "test"},
+	}
+	require.Nil(t, rg.Register(info))
+	defer rg.Deregister(info)
+
+	require.True(t, server.UpdateInstance(polarisDefaultNamespace, serviceName, "127.0.0.1", 6666,
+		func(ins *polaristest.Instance) {
+			ins.Weight = 1
+			ins.Isolated = true
+			ins.Metadata = nil
+		}))
+	require.Eventually(t, func() bool {
+		ins := instanceAt(server, "127.0.0.1", 6666)
+		return ins.Weight == 50 && !ins.Isolated && ins.Metadata["env"] == "test"
+	}, time.Second, time.Millisecond)
+
+	// deregistered instances are not repaired.
+	require.Nil(t, rg.Deregister(info))
+	time.Sleep(10 * time.Millisecond)
+	require.Empty(t, server.Instances(polarisDefaultNamespace, serviceName))
+}
+
+func TestReconcileKeepIsolated(t *testing.T) {
+	desired, _, err := createRegisterParam(&registry.Info{
+		ServiceName: serviceName,
+		Addr:        utils.NewNetAddr("tcp", "127.0.0.1:6666"),
+	}, GetLocalIPv4Address)
+	require.Nil(t, err)
+	actual := &polaristest.Instance{Host: "127.0.0.1", Port: 6666, Protocol: "tcp", Weight: 100, Isolated: true}
+	require.Equal(t, []string{"isolated"}, instanceDrift(desired, actual, false))
+	require.Empty(t, instanceDrift(desired, actual, true))
+	require.Equal(t, []string{"missing"}, instanceDrift(desired, nil, false))
+}
+
+func TestTagsAsMetadata(t *testing.T) {
+	req, _, err := createRegisterParam(&registry.Info{
+		ServiceName: serviceName,
+		Addr:        utils.NewNetAddr("tcp", "127.0.0.1:6666"),
+		Tags:        map[string]string{"env": "test"},
+	}, GetLocalIPv4Address)
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"env": "test"}, req.Metadata)
+
+	ins := ChangePolarisInstanceToKitex(&polaristest.Instance{
+		Namespace: req.Namespace, Host: "127.0.0.1", Port: 6666, Metadata: req.Metadata,
+	})
+	env, _ := ins.Tag("env")
+	require.Equal(t, "test", env)
+	namespace, _ := ins.Tag("namespace")
+	require.Equal(t, polarisDefaultNamespace, namespace)
+}
@@ -26,12 +26,12 @@ import (
 	"github.com/cloudwego/kitex/pkg/registry"
 	perrors "github.com/pkg/errors"
 	"github.com/polarismesh/polaris-go/api"
-	"github.com/polarismesh/polaris-go/pkg/log"
 	"github.com/polarismesh/polaris-go/pkg/model"
 )
 
 var (
 	defaultHeartbeatIntervalSec = 5
+	defaultPolarisWeight        = 100
 	registerTimeout             = 10 * time.Second
 	heartbeatTimeout            = 5 * time.Second
 	heartbeatTime               = 5 * time.Second
@@ -44,9 +44,27 @@ type Registry interface {
 	doHeartbeat(ctx context.Context, ins *api.InstanceRegisterRequest)
 }
 
+// ContextRegistry is a registry whose operations honor the deadline and the cancellation of a context,
+// the registries created by NewPolarisRegistry and its variants implement it.
+type ContextRegistry interface {
+	RegisterContext(ctx context.Context, info *registry.Info) error
+	DeregisterContext(ctx context.Context, info *registry.Info) error
+}
+
 type polarisHeartbeat struct {
 	cancel      context.CancelFunc
 	instanceKey string
+	// registered is false while registration waits for the readiness check.
+	registered bool
+	// pending is closed once the registration waiting for the readiness check is over.
+	pending chan struct{}
+	// request is the desired state of the instance in polaris, guarded by polarisRegistry.lock.
+	request *api.InstanceRegisterRequest
+	// opLock serializes the writes to polaris made in the background with Deregister.
+	opLock sync.Mutex
+	// lastHeartbeat and heartbeatErr are the outcome of the last heartbeat, guarded by polarisRegistry.lock.
+	lastHeartbeat time.Time
+	heartbeatErr  error
 }
 
 // polarisRegistry is a registry using polaris.
@@ -55,6 +73,11 @@ type polarisRegistry struct {
 	provider    api.ProviderAPI
 	lock        *sync.RWMutex
 	registryIns map[string]*polarisHeartbeat
+	opts        *registryOptions
+	// observers are those of the options, and those added by addObserver, guarded by lock.
+	observers []RegistryObserver
+	// heartbeatInterval is heartbeatTime when the registry was created.
+	heartbeatInterval time.Duration
 }
 
 // NewPolarisRegistry creates a polaris based registry.
@@ -64,81 +87,320 @@ func NewPolarisRegistry(configFile ...string) (Registry, error) {
 		return nil, err
 	}
 
+	return NewPolarisRegistryByContext(sdkCtx), nil
+}
+
+// NewPolarisRegistryByContext creates a polaris based registry from an existing SDKContext.
+func NewPolarisRegistryByContext(sdkCtx api.SDKContext, opts ...RegistryOption) Registry {
+	return NewPolarisRegistryByAPI(api.NewProviderAPIByContext(sdkCtx), api.NewConsumerAPIByContext(sdkCtx), opts...)
+}
+
+// NewPolarisRegistryByAPI creates a polaris based registry on top of the given polaris APIs,
+// such as the in-memory ones of the polaristest package.
+func NewPolarisRegistryByAPI(provider api.ProviderAPI, consumer api.ConsumerAPI, opts ...RegistryOption) Registry {
+	o := newRegistryOptions(opts)
 	pRegistry := &polarisRegistry{
-		consumer:    api.NewConsumerAPIByContext(sdkCtx),
-		provider:    api.NewProviderAPIByContext(sdkCtx),
+		consumer:    o.metrics.wrapConsumer(consumer),
+		provider:    o.metrics.wrapProvider(provider),
 		registryIns: make(map[string]*polarisHeartbeat),
 		lock:        &sync.RWMutex{},
+		opts:        o,
+		observers:   o.observers,
+
+		heartbeatInterval: heartbeatTime,
 	}
 
-	return pRegistry, nil
+	return pRegistry
 }
 
 // Register registers a server with given registry info.
+// Every address of the server is registered, if one fails the others are deregistered again.
 func (svr *polarisRegistry) Register(info *registry.Info) error {
+	return svr.RegisterContext(context.Background(), info)
+}
+
+// RegisterContext implements the ContextRegistry interface, like Register.
+// A registration abandoned as ctx is done may still complete in polaris, the instance is then deregistered.
+func (svr *polarisRegistry) RegisterContext(ctx context.Context, info *registry.Info) error {
 	if err := validateInfo(info); err != nil {
 		return err
 	}
-	param, instanceKey, err := createRegisterParam(info)
+	infos, err := svr.expandInfo(info)
 	if err != nil {
 		return err
 	}
-	resp, err := svr.provider.Register(param)
+	for i, ins := range infos {
+		if err := svr.registerInstance(ctx, ins); err != nil {
+			for _, registered := range infos[:i] {
+				if err := svr.deregisterInstance(context.Background(), registered); err != nil {
+					svr.opts.logger.Error("fail to roll back registration", "addr", registered.Addr, "err", err)
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// registerInstance registers one address of a server.
+func (svr *polarisRegistry) registerInstance(ctx context.Context, info *registry.Info) error {
+	param, instanceKey, err := createRegisterParam(info, svr.opts.localIP)
 	if err != nil {
 		return err
 	}
-	if resp.Existed {
-		log.GetBaseLogger().Warnf("instance already registered, namespace:%s, service:%s, port:%s",
-			param.Namespace, param.Service, param.Host)
+	if svr.opts.infoWeight && info.Weight > 0 {
+		weight := info.Weight
+		param.Weight = &weight
 	}
-	ctx, cancel := context.WithCancel(context.Background())
-	go svr.doHeartbeat(ctx, param)
-	svr.lock.Lock()
-	defer svr.lock.Unlock()
-	svr.registryIns[instanceKey] = &polarisHeartbeat{
+	warmupDuration, targetWeight := svr.warmupPlan(info, param)
+	if warmupDuration > 0 {
+		startWeight := svr.opts.warmup.StartWeight
+		param.Weight = &startWeight
+	}
+	tasksCtx, cancel := context.WithCancel(context.Background())
+	insHeartbeat := &polarisHeartbeat{
 		instanceKey: instanceKey,
 		cancel:      cancel,
+		request:     param,
+	}
+	if svr.opts.readiness != nil {
+		insHeartbeat.pending = make(chan struct{})
+		svr.lock.Lock()
+		svr.replaceInstance(instanceKey, insHeartbeat)
+		svr.lock.Unlock()
+		go svr.registerWhenReady(tasksCtx, insHeartbeat, warmupDuration, targetWeight)
+		return nil
+	}
+	if err := svr.doRegister(ctx, tasksCtx, insHeartbeat, warmupDuration, targetWeight); err != nil {
+		cancel()
+		svr.notify(EventRegistered, instanceKey, param, err)
+		return err
+	}
+	svr.lock.Lock()
+	insHeartbeat.registered = true
+	svr.opts.metrics.addRegistered(param.Namespace, param.Service, 1)
+	svr.replaceInstance(instanceKey, insHeartbeat)
+	svr.lock.Unlock()
+	svr.notify(EventRegistered, instanceKey, param, nil)
+	return nil
+}
+
+// replaceInstance stores insHeartbeat and stops the background tasks of a former registration
+// of the same instance, it must be called with svr.lock held.
+func (svr *polarisRegistry) replaceInstance(instanceKey string, insHeartbeat *polarisHeartbeat) {
+	if former, ok := svr.registryIns[instanceKey]; ok {
+		former.cancel()
+		if former.registered {
+			svr.opts.metrics.addRegistered(former.request.Namespace, former.request.Service, -1)
+		}
+	}
+	svr.registryIns[instanceKey] = insHeartbeat
+}
+
+// removeInstance forgets insHeartbeat unless it has been replaced, it must be called with svr.lock held.
+func (svr *polarisRegistry) removeInstance(insHeartbeat *polarisHeartbeat) {
+	insHeartbeat.cancel()
+	if svr.registryIns[insHeartbeat.instanceKey] == insHeartbeat {
+		delete(svr.registryIns, insHeartbeat.instanceKey)
+	}
+}
+
+// doRegister registers the instance to polaris, within ctx, and starts its background tasks,
+// which stop when tasksCtx is done.
+func (svr *polarisRegistry) doRegister(ctx, tasksCtx context.Context, insHeartbeat *polarisHeartbeat,
+	warmupDuration time.Duration, targetWeight int) error {
+	param := insHeartbeat.request
+	var resp *model.InstanceRegisterResponse
+	err := svr.opts.registerRetry.do(ctx, svr.opts.logger, "register", func(ctx context.Context) (err error) {
+		resp, err = svr.register(ctx, param)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Existed {
+		svr.opts.logger.Warn("instance already registered",
+			"namespace", param.Namespace, "service", param.Service, "host", param.Host, "port", param.Port)
+	}
+	go svr.doHeartbeat(tasksCtx, param)
+	if warmupDuration > 0 {
+		go svr.doWarmup(tasksCtx, insHeartbeat, warmupDuration, targetWeight)
+	}
+	if svr.opts.reconcile != nil {
+		go svr.doReconcile(tasksCtx, insHeartbeat)
 	}
 	return nil
 }
 
 // Deregister deregisters a server with given registry info.
+// Every address of the server is deregistered, the first failure is returned.
 func (svr *polarisRegistry) Deregister(info *registry.Info) error {
+	return svr.DeregisterContext(context.Background(), info)
+}
+
+// DeregisterContext implements the ContextRegistry interface, like Deregister.
+func (svr *polarisRegistry) DeregisterContext(ctx context.Context, info *registry.Info) error {
 	if err := validateInfo(info); err != nil {
 		return err
 	}
-	request, instanceKey, err := createDeregisterParam(info)
+	infos, err := svr.expandInfo(info)
 	if err != nil {
 		return err
 	}
-	svr.lock.RLock()
+	var firstErr error
+	for _, ins := range infos {
+		if err := svr.deregisterInstance(ctx, ins); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// deregisterInstance deregisters one address of a server.
+func (svr *polarisRegistry) deregisterInstance(ctx context.Context, info *registry.Info) error {
+	request, instanceKey, err := createDeregisterParam(info, svr.opts.localIP)
+	if err != nil {
+		return err
+	}
+	svr.lock.Lock()
 	insHeartbeat, ok := svr.registryIns[instanceKey]
-	svr.lock.RUnlock()
+	registered := ok && insHeartbeat.registered
+	var param *api.InstanceRegisterRequest
+	if ok {
+		param = insHeartbeat.request
+	}
+	if ok && !registered {
+		// still waiting for the readiness check, nothing has been sent to polaris.
+		insHeartbeat.cancel()
+		delete(svr.registryIns, instanceKey)
+	}
+	svr.lock.Unlock()
 	if !ok {
 		err = perrors.Errorf("instance{%s} has not registered", instanceKey)
 		return err
 	}
-	err = svr.provider.Deregister(request)
-	if err != nil {
-		return perrors.WithMessagef(err, "instance{%s} deregister fail (err:%+v)", instanceKey, err)
-	} else {
+	if !registered {
+		// the instance may be reaching polaris, registerWhenReady removes it then.
+		select {
+		case <-insHeartbeat.pending:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	insHeartbeat.opLock.Lock()
+	err = svr.deregister(ctx, request)
+	if err == nil {
 		svr.lock.Lock()
 		insHeartbeat.cancel()
 		delete(svr.registryIns, instanceKey)
+		svr.opts.metrics.addRegistered(request.Namespace, request.Service, -1)
 		svr.lock.Unlock()
 	}
+	// the observers may register or deregister the instance again.
+	insHeartbeat.opLock.Unlock()
+	svr.notify(EventDeregistered, instanceKey, param, err)
+	if err != nil {
+		return perrors.WithMessagef(err, "instance{%s} deregister fail (err:%+v)", instanceKey, err)
+	}
 
 	return nil
 }
 
+// deregister removes the instance from polaris, retrying according to the deregister policy.
+func (svr *polarisRegistry) deregister(ctx context.Context, request *api.InstanceDeRegisterRequest) error {
+	return svr.opts.deregisterRetry.do(ctx, svr.opts.logger, "deregister", func(ctx context.Context) error {
+		_, span := svr.opts.tracer.start(ctx, "Deregister", request.Namespace, request.Service,
+			attrHost.String(request.Host), attrPort.Int(request.Port))
+		req := *request
+		req.Timeout = requestTimeout(ctx, request.Timeout)
+		err := callContext(ctx, func() error {
+			return svr.provider.Deregister(&req)
+		})
+		endSpan(span, err)
+		return err
+	})
+}
+
+// register registers, or updates, the instance in polaris.
+func (svr *polarisRegistry) register(ctx context.Context, req *api.InstanceRegisterRequest) (*model.InstanceRegisterResponse, error) {
+	_, span := svr.opts.tracer.start(ctx, "Register", req.Namespace, req.Service,
+		attrHost.String(req.Host), attrPort.Int(req.Port))
+	timed := *req
+	timed.Timeout = requestTimeout(ctx, req.Timeout)
+	var resp *model.InstanceRegisterResponse
+	err := callContextUndo(ctx, func() (err error) {
+		resp, err = svr.provider.Register(&timed)
+		return err
+	}, func() {
+		svr.undoRegister(req)
+	})
+	endSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// undoRegister deregisters an instance whose abandoned registration succeeded,
+// unless it has been registered again since.
+func (svr *polarisRegistry) undoRegister(req *api.InstanceRegisterRequest) {
+	instanceKey := GetInstanceKey(req.Namespace, req.Service, req.Host, strconv.Itoa(req.Port))
+	svr.lock.RLock()
+	insHeartbeat, ok := svr.registryIns[instanceKey]
+	registered := ok && insHeartbeat.registered
+	svr.lock.RUnlock()
+	if registered {
+		return
+	}
+	svr.opts.logger.Warn("abandoned registration succeeded, deregistering the instance", "instance", instanceKey)
+	if err := svr.deregister(context.Background(), createDeregisterRequest(req)); err != nil {
+		svr.opts.logger.Error("fail to deregister abandoned registration", "instance", instanceKey, "err", err)
+	}
+}
+
+// heartbeat reports the instance is alive to polaris.
+func (svr *polarisRegistry) heartbeat(ctx context.Context, req *api.InstanceHeartbeatRequest) error {
+	_, span := svr.opts.tracer.start(ctx, "Heartbeat", req.Namespace, req.Service,
+		attrHost.String(req.Host), attrPort.Int(req.Port))
+	timed := *req
+	timed.Timeout = requestTimeout(ctx, req.Timeout)
+	err := callContext(ctx, func() error {
+		return svr.provider.Heartbeat(&timed)
+	})
+	endSpan(span, err)
+	return err
+}
+
 // IsAvailable always return true when use polaris.
 func (svr *polarisRegistry) IsAvailable() bool {
 	return true
 }
 
+// warmupPlan returns the warm-up window and target weight for info, the window is zero when warm-up does not apply.
+func (svr *polarisRegistry) warmupPlan(info *registry.Info, param *api.InstanceRegisterRequest) (time.Duration, int) {
+	warmup := svr.opts.warmup
+	if warmup == nil {
+		return 0, 0
+	}
+	duration := warmup.Duration
+	if info.WarmUp > 0 {
+		duration = info.WarmUp
+	}
+	target := defaultPolarisWeight
+	if param.Weight != nil {
+		target = *param.Weight
+	}
+	if target <= warmup.StartWeight {
+		return 0, 0
+	}
+	return duration, target
+}
+
 // doHeartbeat Since polaris does not support automatic reporting of instance heartbeats, separate logic is needed to implement it.
 func (svr *polarisRegistry) doHeartbeat(ctx context.Context, ins *api.InstanceRegisterRequest) {
-	ticker := time.NewTicker(heartbeatTime)
+	ticker := time.NewTicker(svr.heartbeatInterval)
+	instanceKey := GetInstanceKey(ins.Namespace, ins.Service, ins.Host, strconv.Itoa(ins.Port))
 
 	heartbeat := &api.InstanceHeartbeatRequest{
 		InstanceHeartbeatRequest: model.InstanceHeartbeatRequest{
@@ -155,7 +417,19 @@ func (svr *polarisRegistry) doHeartbeat(ctx context.Context, ins *api.InstanceRe
 			ticker.Stop()
 			return
 		case <-ticker.C:
-			svr.provider.Heartbeat(heartbeat)
+			err := svr.heartbeat(ctx, heartbeat)
+			if ctx.Err() != nil {
+				ticker.Stop()
+				return
+			}
+			svr.lock.Lock()
+			if insHeartbeat, ok := svr.registryIns[instanceKey]; ok {
+				insHeartbeat.lastHeartbeat, insHeartbeat.heartbeatErr = time.Now(), err
+			}
+			svr.lock.Unlock()
+			if err != nil {
+				svr.notify(EventHeartbeatFailed, instanceKey, ins, err)
+			}
 		}
 	}
 }
@@ -178,8 +452,8 @@ func validateInfo(info *registry.Info) error {
 }
 
 // createRegisterParam convert registry.Info to polaris instance register request.
-func createRegisterParam(info *registry.Info) (*api.InstanceRegisterRequest, string, error) {
-	instanceHost, instancePort, err := GetInfoHostAndPort(info.Addr.String())
+func createRegisterParam(info *registry.Info, localIP func() (string, error)) (*api.InstanceRegisterRequest, string, error) {
+	instanceHost, instancePort, err := getInfoHostAndPort(info.Addr.String(), localIP)
 	if err != nil {
 		return nil, "", err
 	}
@@ -191,6 +465,18 @@ func createRegisterParam(info *registry.Info) (*api.InstanceRegisterRequest, str
 	}
 	instanceKey := GetInstanceKey(namespace, info.ServiceName, instanceHost, strconv.Itoa(instancePort))
 
+	// tags are registered as metadata so that they are resolved back as instance tags,
+	// but the addresses of the server, which are registered as instances of their own.
+	var metadata map[string]string
+	for k, v := range info.Tags {
+		if k == AdditionalAddrsTag {
+			continue
+		}
+		if metadata == nil {
+			metadata = make(map[string]string, len(info.Tags))
+		}
+		metadata[k] = v
+	}
 	req := &api.InstanceRegisterRequest{
 		InstanceRegisterRequest: model.InstanceRegisterRequest{
 			Service:   info.ServiceName,
@@ -198,6 +484,7 @@ func createRegisterParam(info *registry.Info) (*api.InstanceRegisterRequest, str
 			Host:      instanceHost,
 			Port:      instancePort,
 			Protocol:  &protocol,
+			Metadata:  metadata,
 			Timeout:   model.ToDurationPtr(registerTimeout),
 			TTL:       &defaultHeartbeatIntervalSec,
 			// If the TTL field is not set, polaris will think that this instance does not need to perform the heartbeat health check operation,
@@ -209,8 +496,8 @@ func createRegisterParam(info *registry.Info) (*api.InstanceRegisterRequest, str
 }
 
 // createDeregisterParam convert registry.info to polaris instance deregister request.
-func createDeregisterParam(info *registry.Info) (*api.InstanceDeRegisterRequest, string, error) {
-	instanceHost, instancePort, err := GetInfoHostAndPort(info.Addr.String())
+func createDeregisterParam(info *registry.Info, localIP func() (string, error)) (*api.InstanceDeRegisterRequest, string, error) {
+	instanceHost, instancePort, err := getInfoHostAndPort(info.Addr.String(), localIP)
 	if err != nil {
 		return nil, "", err
 	}
@@ -231,3 +518,15 @@ func createDeregisterParam(info *registry.Info) (*api.InstanceDeRegisterRequest,
 	}
 	return req, instanceKey, nil
 }
+
+// createDeregisterRequest builds the deregister request matching a register request.
+func createDeregisterRequest(param *api.InstanceRegisterRequest) *api.InstanceDeRegisterRequest {
+	return &api.InstanceDeRegisterRequest{
+		InstanceDeRegisterRequest: model.InstanceDeRegisterRequest{
+			Service:   param.Service,
+			Namespace: param.Namespace,
+			Host:      param.Host,
+			Port:      param.Port,
+		},
+	}
+}
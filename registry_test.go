@@ -0,0 +1,136 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/discovery"
+	"github.com/cloudwego/kitex/pkg/registry"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"github.com/cloudwego/kitex/pkg/utils"
+	"github.com/kitex-contrib/registry-polaris/polaristest"
+	"github.com/polarismesh/polaris-go/api"
+	"github.com/polarismesh/polaris-go/pkg/config"
+	"github.com/polarismesh/polaris-go/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryWithFakePolaris(t *testing.T) {
+	server := polaristest.NewServer()
+	rg := NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI())
+	rs := NewPolarisResolverByAPI(server.ProviderAPI(), server.ConsumerAPI())
+
+	info := &registry.Info{
+		ServiceName: serviceName,
+		Addr:        utils.NewNetAddr("tcp", "127.0.0.1:6666"),
+		Weight:      100,
+	}
+	require.Nil(t, rg.Register(info))
+
+	desc := rs.Target(context.TODO(), rpcinfo.NewEndpointInfo(serviceName, "", nil, nil))
+	result, err := rs.Resolve(context.TODO(), desc)
+	require.Nil(t, err)
+	require.Equal(t, []discovery.Instance{
+		discovery.NewInstance("tcp", "127.0.0.1:6666", 100, map[string]string{"namespace": "default"}),
+	}, result.Instances)
+
+	// no heartbeat within the TTL
+	server.Advance(time.Duration(defaultHeartbeatIntervalSec+1) * time.Second)
+	_, err = rs.Resolve(context.TODO(), desc)
+	require.NotNil(t, err)
+
+	require.Nil(t, rg.Deregister(info))
+	require.Empty(t, server.Instances(polarisDefaultNamespace, serviceName))
+	require.NotNil(t, rg.Deregister(info))
+}
+
+func TestRegistryRetry(t *testing.T) {
+	server := polaristest.NewServer()
+	rg := NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI(),
+		WithRegisterRetry(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}))
+	info := &registry.Info{
+		ServiceName: serviceName,
+		Addr:        utils.NewNetAddr("tcp", "127.0.0.1:6666"),
+	}
+
+	server.InjectError(polaristest.OpRegister, model.NewSDKError(model.ErrCodeNetworkError, nil, "network"), 2)
+	require.Nil(t, rg.Register(info))
+	require.Equal(t, 3, server.Calls(polaristest.OpRegister))
+	require.Nil(t, rg.Deregister(info))
+
+	server.InjectError(polaristest.OpRegister, model.NewSDKError(model.ErrCodeAPIInvalidArgument, nil, "invalid"), 0)
+	require.NotNil(t, rg.Register(info))
+	require.Equal(t, 4, server.Calls(polaristest.OpRegister))
+}
+
+func TestWatcherWithFakePolaris(t *testing.T) {
+	server := polaristest.NewServer()
+	rg := NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI())
+	rs := NewPolarisResolverByAPI(server.ProviderAPI(), server.ConsumerAPI())
+	first := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+	second := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:7777")}
+	require.Nil(t, rg.Register(first))
+	defer rg.Deregister(first)
+
+	desc := rs.Target(context.TODO(), rpcinfo.NewEndpointInfo(serviceName, "", nil, nil))
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		rg.Register(second)
+	}()
+	change, err := rs.Watcher(context.TODO(), desc)
+	require.Nil(t, err)
+	// the result holds the instances once changed.
+	require.Len(t, change.Result.Instances, 2)
+	require.Len(t, change.Added, 1)
+	require.Equal(t, "127.0.0.1:7777", change.Added[0].Address().String())
+	require.Nil(t, rg.Deregister(second))
+}
+
+func TestRegistryWithGRPCPolaris(t *testing.T) {
+	server := polaristest.NewGRPCServer(polaristest.NewServer())
+	require.Nil(t, server.Start("127.0.0.1:0"))
+	defer server.Stop()
+
+	cfg := config.NewDefaultConfiguration([]string{server.Addr()})
+	cfg.GetConsumer().GetLocalCache().SetPersistDir(t.TempDir())
+	sdkCtx, err := api.InitContextByConfig(cfg)
+	require.Nil(t, err)
+	defer sdkCtx.Destroy()
+	rg := NewPolarisRegistryByContext(sdkCtx)
+	rs := NewPolarisResolverByContext(sdkCtx)
+
+	info := &registry.Info{
+		ServiceName: serviceName,
+		Addr:        utils.NewNetAddr("tcp", "127.0.0.1:6666"),
+		Weight:      100,
+	}
+	require.Nil(t, rg.Register(info))
+	desc := rs.Target(context.TODO(), rpcinfo.NewEndpointInfo(serviceName, "", nil, nil))
+	result, err := rs.Resolve(context.TODO(), desc)
+	require.Nil(t, err)
+	require.Len(t, result.Instances, 1)
+	require.Equal(t, "127.0.0.1:6666", result.Instances[0].Address().String())
+
+	server.SetFault(polaristest.OpRegister, polaristest.Fault{Code: 500000})
+	require.NotNil(t, rg.Register(&registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:7777")}))
+	server.SetFault(polaristest.OpRegister, polaristest.Fault{})
+
+	require.Nil(t, rg.Deregister(info))
+}
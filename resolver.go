@@ -20,11 +20,12 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/cloudwego/kitex/pkg/discovery"
 	"github.com/cloudwego/kitex/pkg/rpcinfo"
 	"github.com/polarismesh/polaris-go/api"
-	"github.com/polarismesh/polaris-go/pkg/log"
 	"github.com/polarismesh/polaris-go/pkg/model"
 )
 
@@ -44,6 +45,33 @@ type Resolver interface {
 type polarisResolver struct {
 	provider api.ProviderAPI
 	consumer api.ConsumerAPI
+	opts     *resolverOptions
+
+	// lock guards the state exposed by the debug handler.
+	lock sync.Mutex
+	// watchers counts, per description, the running Watcher calls.
+	watchers map[string]int
+	// resolved holds, per description, the outcome of the last Resolve.
+	resolved map[string]*resolvedState
+	// subscriptions holds, per description, the watch feeding the subscriptions.
+	subscriptions map[string]*serviceWatch
+	// watcherQueues holds, per description, the changes queued for Watcher.
+	watcherQueues map[string]*changeQueue
+	// diffStates holds the polaris state of the resolved instances for Diff.
+	diffStates *diffStates
+
+	cache *resolveCache
+	// snapshots saves the resolved instances when a snapshot is configured.
+	snapshots *snapshotWriter
+	// staticFallback serves the static instances when a static fallback is configured.
+	staticFallback *staticFallback
+}
+
+// resolvedState is the outcome of the last Resolve, instances are those of the last successful one.
+type resolvedState struct {
+	at        time.Time
+	instances []discovery.Instance
+	err       error
 }
 
 // NewPolarisResolver creates a polaris based resolver.
@@ -53,12 +81,37 @@ func NewPolarisResolver(configFile ...string) (Resolver, error) {
 		return nil, err
 	}
 
+	return NewPolarisResolverByContext(sdkCtx), nil
+}
+
+// NewPolarisResolverByContext creates a polaris based resolver from an existing SDKContext.
+func NewPolarisResolverByContext(sdkCtx api.SDKContext, opts ...ResolverOption) Resolver {
+	return NewPolarisResolverByAPI(api.NewProviderAPIByContext(sdkCtx), api.NewConsumerAPIByContext(sdkCtx), opts...)
+}
+
+// NewPolarisResolverByAPI creates a polaris based resolver on top of the given polaris APIs,
+// such as the in-memory ones of the polaristest package.
+func NewPolarisResolverByAPI(provider api.ProviderAPI, consumer api.ConsumerAPI, opts ...ResolverOption) Resolver {
+	o := newResolverOptions(opts)
 	newInstance := &polarisResolver{
-		consumer: api.NewConsumerAPIByContext(sdkCtx),
-		provider: api.NewProviderAPIByContext(sdkCtx),
+		consumer:      o.metrics.wrapConsumer(consumer),
+		provider:      o.metrics.wrapProvider(provider),
+		opts:          o,
+		watchers:      make(map[string]int),
+		resolved:      make(map[string]*resolvedState),
+		subscriptions: make(map[string]*serviceWatch),
+		watcherQueues: make(map[string]*changeQueue),
+		diffStates:    newDiffStates(),
+		cache:         newResolveCache(o.cache),
+	}
+	if o.snapshot != nil {
+		newInstance.snapshots = newSnapshotWriter(o.snapshot, o.logger)
+	}
+	if o.staticFallback != nil {
+		newInstance.staticFallback = newStaticFallback(o.staticFallback, o.logger, o.metrics)
 	}
 
-	return newInstance, nil
+	return newInstance
 }
 
 // Target implements the Resolver interface.
@@ -79,106 +132,177 @@ func (polaris *polarisResolver) Target(ctx context.Context, target rpcinfo.Endpo
 }
 
 // Watcher return registered service changes.
+// The first call on desc keeps a watch of desc running, its changes are queued for the next calls,
+// which share them.
 func (polaris *polarisResolver) Watcher(ctx context.Context, desc string) (discovery.Change, error) {
-	var (
-		eps    []discovery.Instance
-		add    []discovery.Instance
-		update []discovery.Instance
-		remove []discovery.Instance
-	)
-	namespace, serviceName := SplitDescription(desc)
-	key := model.ServiceKey{
-		Namespace: namespace,
-		Service:   serviceName,
+	polaris.addWatcher(desc, 1)
+	defer polaris.addWatcher(desc, -1)
+	q, err := polaris.watcherQueue(ctx, desc)
+	if ctx.Err() != nil {
+		// the watch has been finished before it started.
+		return discovery.Change{}, nil
 	}
-	watchReq := api.WatchServiceRequest{}
-	watchReq.Key = key
-	watchRsp, err := polaris.consumer.WatchService(&watchReq)
-	if nil != err {
-		log.GetBaseLogger().Fatalf("fail to WatchService, err is %v", err)
+	if err != nil {
+		return discovery.Change{}, err
+	}
+	change, ok := q.next(ctx)
+	if !ok {
+		namespace, serviceName := SplitDescription(desc)
+		polaris.opts.logger.Debug("watch has been finished", "namespace", namespace, "service", serviceName)
 	}
-	instances := watchRsp.GetAllInstancesResp.Instances
+	return change, nil
+}
 
-	if nil != instances {
-		for _, instance := range instances {
-			log.GetBaseLogger().Infof("instance getOneInstance is %s:%d", instance.GetHost(), instance.GetPort())
-			eps = append(eps, ChangePolarisInstanceToKitex(instance))
-		}
+// watcherQueue returns the queue of the changes of desc for Watcher, subscribing it within ctx when there is none.
+func (polaris *polarisResolver) watcherQueue(ctx context.Context, desc string) (*changeQueue, error) {
+	polaris.lock.Lock()
+	q, ok := polaris.watcherQueues[desc]
+	polaris.lock.Unlock()
+	if ok {
+		return q, nil
+	}
+	w, err := polaris.acquireWatch(ctx, desc)
+	if err != nil {
+		return nil, err
 	}
+	polaris.lock.Lock()
+	q, ok = polaris.watcherQueues[desc]
+	if !ok {
+		q = newChangeQueue()
+		polaris.watcherQueues[desc] = q
+	}
+	polaris.lock.Unlock()
+	if ok {
+		// created concurrently.
+		polaris.releaseWatch(w)
+		return q, nil
+	}
+	w.join(&subscription{watch: w, handler: q.push})
+	return q, nil
+}
 
-	result := discovery.Result{
-		Cacheable: true,
-		CacheKey:  desc,
-		Instances: eps,
-	}
-	Change := discovery.Change{}
-
-	select {
-	case <-ctx.Done():
-		log.GetBaseLogger().Infof("[Polaris resolver] Watch has been finished")
-		return Change, nil
-	case event := <-watchRsp.EventChannel:
-		eType := event.GetSubScribeEventType()
-		if eType == api.EventInstance {
-			insEvent := event.(*model.InstanceEvent)
-			if insEvent.AddEvent != nil {
-				for _, instance := range insEvent.AddEvent.Instances {
-					add = append(add, ChangePolarisInstanceToKitex(instance))
-				}
-			}
-			if insEvent.UpdateEvent != nil {
-				for i := range insEvent.UpdateEvent.UpdateList {
-					update = append(update, ChangePolarisInstanceToKitex(insEvent.UpdateEvent.UpdateList[i].After))
-				}
-			}
-			if insEvent.DeleteEvent != nil {
-				for _, instance := range insEvent.DeleteEvent.Instances {
-					remove = append(remove, ChangePolarisInstanceToKitex(instance))
-				}
-			}
-			Change = discovery.Change{
-				Result:  result,
-				Added:   add,
-				Updated: update,
-				Removed: remove,
-			}
-		}
-		return Change, nil
+// addWatcher updates the number of running Watcher calls of desc.
+func (polaris *polarisResolver) addWatcher(desc string, delta int) {
+	polaris.lock.Lock()
+	defer polaris.lock.Unlock()
+	polaris.watchers[desc] += delta
+	if polaris.watchers[desc] <= 0 {
+		delete(polaris.watchers, desc)
 	}
 }
 
 // Resolve implements the Resolver interface.
 func (polaris *polarisResolver) Resolve(ctx context.Context, desc string) (discovery.Result, error) {
-	var eps []discovery.Instance
+	result, err := polaris.resolve(ctx, desc)
+	polaris.lock.Lock()
+	state, ok := polaris.resolved[desc]
+	if !ok {
+		state = &resolvedState{}
+		polaris.resolved[desc] = state
+	}
+	state.at, state.err = time.Now(), err
+	if err == nil {
+		state.instances = result.Instances
+	}
+	polaris.lock.Unlock()
+	return result, err
+}
+
+// resolve gets the instances of desc from polaris, or from the fallbacks.
+func (polaris *polarisResolver) resolve(ctx context.Context, desc string) (discovery.Result, error) {
 	namespace, serviceName := SplitDescription(desc)
-	getInstances := &api.GetInstancesRequest{}
-	getInstances.Namespace = namespace
-	getInstances.Service = serviceName
-	InstanceResp, err := polaris.consumer.GetInstances(getInstances)
-	if nil != err {
-		log.GetBaseLogger().Fatalf("fail to getOneInstance, err is %v", err)
+	entry, err := polaris.cache.get(ctx, desc, func(ctx context.Context, former *cacheEntry) (*cacheEntry, error) {
+		return polaris.fetch(ctx, desc, former)
+	})
+	if ctx.Err() != nil {
+		// the caller gave up, falling back would not be used.
+		return discovery.Result{}, ctx.Err()
 	}
-	instances := InstanceResp.GetInstances()
-	if nil != instances {
-		for _, instance := range instances {
-			log.GetBaseLogger().Infof("instance getOneInstance is %s:%d", instance.GetHost(), instance.GetPort())
-			eps = append(eps, ChangePolarisInstanceToKitex(instance))
-		}
+	if nil != err {
+		polaris.opts.logger.Error("fail to get instances", "namespace", namespace, "service", serviceName, "err", err)
+		return polaris.fallback(desc, err, true)
 	}
 
-	if len(eps) == 0 {
-		return discovery.Result{}, fmt.Errorf("no instance remains for %s", desc)
+	polaris.opts.metrics.setResolved(namespace, serviceName, len(entry.instances))
+	polaris.diffStates.record(desc, entry.states)
+	if len(entry.instances) == 0 {
+		return polaris.fallback(desc, fmt.Errorf("no instance remains for %s", desc), false)
 	}
 	return discovery.Result{
 		Cacheable: true,
 		CacheKey:  desc,
-		Instances: eps,
+		Instances: entry.instances,
 	}, nil
 }
 
+// fetch gets the instances of desc from polaris, the instances of former are reused when the revision is unchanged.
+func (polaris *polarisResolver) fetch(ctx context.Context, desc string, former *cacheEntry) (*cacheEntry, error) {
+	namespace, serviceName := SplitDescription(desc)
+	getInstances := &api.GetInstancesRequest{}
+	getInstances.Namespace = namespace
+	getInstances.Service = serviceName
+	getInstances.Timeout = requestTimeout(ctx, nil)
+	_, span := polaris.opts.tracer.start(ctx, "GetInstances", namespace, serviceName)
+	var InstanceResp *model.InstancesResponse
+	err := callContext(ctx, func() (err error) {
+		InstanceResp, err = polaris.consumer.GetInstances(getInstances)
+		return err
+	})
+	if err == nil {
+		span.SetAttributes(attrInstanceCount.Int(len(InstanceResp.GetInstances())))
+	}
+	endSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+
+	instances := InstanceResp.GetInstances()
+	if polaris.snapshots != nil && len(instances) > 0 {
+		polaris.snapshots.update(desc, InstanceResp.GetRevision(), instances)
+	}
+	entry := &cacheEntry{revision: InstanceResp.GetRevision(), fetchedAt: time.Now()}
+	if former != nil && entry.revision != "" && entry.revision == former.revision {
+		entry.instances, entry.states = former.instances, former.states
+		return entry, nil
+	}
+	entry.instances = make([]discovery.Instance, 0, len(instances))
+	entry.states = newInstanceStates(len(instances))
+	for _, instance := range instances {
+		polaris.opts.logger.Debug("resolved instance", "namespace", namespace, "service", serviceName,
+			"host", instance.GetHost(), "port", instance.GetPort())
+		ins := ChangePolarisInstanceToKitex(instance)
+		entry.instances = append(entry.instances, ins)
+		entry.states.add(ins, instance)
+	}
+	return entry, nil
+}
+
+// fallback resolves desc without polaris, static instances come first so that they can pin
+// clients during a disaster, then the snapshot when polaris is unreachable.
+func (polaris *polarisResolver) fallback(desc string, cause error, unreachable bool) (discovery.Result, error) {
+	if polaris.staticFallback != nil {
+		if result, ok := polaris.staticFallback.fallback(desc, cause); ok {
+			return result, nil
+		}
+	}
+	if unreachable && polaris.opts.snapshot != nil {
+		if result, ok := polaris.opts.snapshot.fallback(polaris.opts.logger, desc); ok {
+			return result, nil
+		}
+	}
+	return discovery.Result{}, cause
+}
+
 // Diff implements the Resolver interface.
 func (polaris *polarisResolver) Diff(cacheKey string, prev, next discovery.Result) (discovery.Change, bool) {
-	return discovery.DefaultDiff(cacheKey, prev, next)
+	return diffResults(cacheKey, prev, next, func(ins discovery.Instance) (instanceState, bool) {
+		return polaris.instanceState(cacheKey, ins)
+	})
+}
+
+// instanceState implements the instanceStater interface.
+func (polaris *polarisResolver) instanceState(desc string, ins discovery.Instance) (instanceState, bool) {
+	return polaris.diffStates.get(desc, ins)
 }
 
 // Name implements the Resolver interface.
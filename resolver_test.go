@@ -25,6 +25,7 @@ import (
 	"github.com/cloudwego/kitex/pkg/registry"
 	"github.com/cloudwego/kitex/pkg/rpcinfo"
 	"github.com/cloudwego/kitex/pkg/utils"
+	"github.com/kitex-contrib/registry-polaris/polaristest"
 	"github.com/stretchr/testify/require"
 )
 
@@ -33,10 +34,9 @@ const (
 )
 
 func TestPolarisResolver(t *testing.T) {
-	rg, err := NewPolarisRegistry()
-	require.Nil(t, err)
-	rs, err := NewPolarisResolver()
-	require.Nil(t, err)
+	server := polaristest.NewServer()
+	rg := NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI(), WithInfoWeight())
+	rs := NewPolarisResolverByAPI(server.ProviderAPI(), server.ConsumerAPI())
 
 	// test register service
 	InstanceOne := &registry.Info{
@@ -45,9 +45,8 @@ func TestPolarisResolver(t *testing.T) {
 		Weight:      100,
 		Tags:        nil, // when Tags is nil the namespace is default
 	}
-	err = rg.Register(InstanceOne)
+	err := rg.Register(InstanceOne)
 	require.Nil(t, err)
-	time.Sleep(15 * time.Second)                                                          // wait register service
 	desc := rs.Target(context.TODO(), rpcinfo.NewEndpointInfo(serviceName, "", nil, nil)) // the namespace is default
 	result, err := rs.Resolve(context.TODO(), desc)
 	require.Nil(t, err)
@@ -61,9 +60,12 @@ func TestPolarisResolver(t *testing.T) {
 		},
 	}
 	require.Equal(t, expected, result)
-	watcherChange, err := rs.Watcher(context.TODO(), desc)
+	// the changes are watched from the first watch on, a watch cancelled before any change subscribes.
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	watcherChange, err := rs.Watcher(ctx, desc)
+	cancel()
 	require.Nil(t, err)
-	t.Logf("the number of instance is %d", len(watcherChange.Result.Instances))
+	require.Empty(t, watcherChange.Added)
 
 	// test register service
 	InstanceTwo := &registry.Info{
@@ -74,23 +76,26 @@ func TestPolarisResolver(t *testing.T) {
 	}
 	err = rg.Register(InstanceTwo)
 	require.Nil(t, err)
-	time.Sleep(15 * time.Second) // wait register service
 	watcherChange, err = rs.Watcher(context.TODO(), desc)
 	require.Nil(t, err)
-	t.Logf("the number of instance is %d", len(watcherChange.Result.Instances))
-	_, err = rs.Resolve(context.TODO(), desc)
+	require.Equal(t, []string{"127.0.0.1:7777"}, addresses(watcherChange.Added))
+	result, err = rs.Resolve(context.TODO(), desc)
 	require.Nil(t, err)
+	require.Len(t, result.Instances, 2)
 
 	// test deregister service
-
 	err = rg.Deregister(InstanceOne) // deregister InstanceOne
 	require.Nil(t, err)
 	err = rg.Deregister(InstanceTwo) // deregister InstanceTwo
 	require.Nil(t, err)
-	time.Sleep(15 * time.Second) // wait deregister service
-	watcherChange, err = rs.Watcher(context.TODO(), desc)
-	require.Nil(t, err)
-	t.Logf("the number of instance is %d", len(watcherChange.Result.Instances))
+	// the changes queued between two calls are merged.
+	var removed []string
+	for len(removed) < 2 {
+		watcherChange, err = rs.Watcher(context.TODO(), desc)
+		require.Nil(t, err)
+		removed = append(removed, addresses(watcherChange.Removed)...)
+	}
+	require.Equal(t, []string{"127.0.0.1:6666", "127.0.0.1:7777"}, removed)
 	desc = rs.Target(context.TODO(), rpcinfo.NewEndpointInfo(serviceName, "", nil, nil)) // namespace is  default
 	_, err = rs.Resolve(context.TODO(), desc)
 	require.NotNil(t, err)
@@ -0,0 +1,135 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	perrors "github.com/pkg/errors"
+	"github.com/polarismesh/polaris-go/pkg/model"
+)
+
+const (
+	defaultRetryMaxAttempts    = 3
+	defaultRetryInitialBackoff = 100 * time.Millisecond
+	defaultRetryMaxBackoff     = 5 * time.Second
+	defaultRetryMultiplier     = 2
+	defaultRetryJitter         = 0.2
+)
+
+// RetryPolicy controls how a failed polaris call is retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts including the first one.
+	// Zero means no limit besides Deadline, or 3 attempts when Deadline is not set either.
+	MaxAttempts int
+	// InitialBackoff is the pause before the first retry, 100ms by default.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the pause between two attempts, 5s by default.
+	MaxBackoff time.Duration
+	// Multiplier grows the pause after every attempt, 2 by default.
+	Multiplier float64
+	// Jitter randomizes each pause by up to this fraction of it, 0.2 by default.
+	Jitter float64
+	// Deadline bounds the time spent on all attempts, zero means no bound.
+	Deadline time.Duration
+	// Retryable decides whether an error is worth another attempt, IsRetryableError by default.
+	Retryable func(err error) bool
+}
+
+func (p *RetryPolicy) fillDefaults() {
+	if p.MaxAttempts <= 0 && p.Deadline <= 0 {
+		p.MaxAttempts = defaultRetryMaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = defaultRetryInitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = defaultRetryMaxBackoff
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = defaultRetryMultiplier
+	}
+	if p.Jitter <= 0 || p.Jitter > 1 {
+		p.Jitter = defaultRetryJitter
+	}
+	if p.Retryable == nil {
+		p.Retryable = IsRetryableError
+	}
+}
+
+// backoff returns the pause before the given retry, counted from 1.
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	backoff := float64(p.InitialBackoff)
+	for i := 1; i < retry && backoff < float64(p.MaxBackoff); i++ {
+		backoff *= p.Multiplier
+	}
+	if backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	backoff += backoff * p.Jitter * (2*rand.Float64() - 1)
+	return time.Duration(backoff)
+}
+
+// do calls fn until it succeeds, fails with a non-retryable error or the policy is exhausted.
+// fn is given ctx, bounded by the Deadline of the policy. A nil policy calls fn exactly once.
+func (p *RetryPolicy) do(ctx context.Context, logger Logger, op string, fn func(ctx context.Context) error) error {
+	if p == nil {
+		return fn(ctx)
+	}
+	if p.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Deadline)
+		defer cancel()
+	}
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || !p.Retryable(err) {
+			return err
+		}
+		if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+			return perrors.WithMessagef(err, "%s fail after %d attempts", op, attempt)
+		}
+		backoff := p.backoff(attempt)
+		logger.Warn("polaris operation failed, retrying", "op", op, "attempt", attempt, "backoff", backoff, "err", err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return perrors.WithMessagef(err, "%s fail after %d attempts (%v)", op, attempt, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// IsRetryableError reports whether err is a transient polaris failure, such as a
+// timeout, a network error or a server side exception, that may succeed on retry.
+func IsRetryableError(err error) bool {
+	var sdkErr model.SDKError
+	if !errors.As(err, &sdkErr) {
+		return false
+	}
+	switch sdkErr.ErrorCode() {
+	case model.ErrCodeAPITimeoutError, model.ErrCodeNetworkError, model.ErrCodeServerException,
+		model.ErrCodeConnectError, model.ErrCodeServerError, model.ErrorCodeRpcError,
+		model.ErrorCodeRpcTimeout, model.ErrCodeRequestLimit, model.ErrCodeUnknownServerError:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	perrors "github.com/pkg/errors"
+	"github.com/polarismesh/polaris-go/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	policy.fillDefaults()
+
+	retryable := perrors.WithMessage(model.NewSDKError(model.ErrCodeNetworkError, nil, "network"), "register")
+	attempts := 0
+	err := policy.do(context.Background(), globalLogger{}, "register", func(context.Context) error {
+		attempts++
+		return retryable
+	})
+	require.NotNil(t, err)
+	require.Equal(t, 3, attempts)
+
+	attempts = 0
+	err = policy.do(context.Background(), globalLogger{}, "register", func(context.Context) error {
+		attempts++
+		return model.NewSDKError(model.ErrCodeAPIInvalidArgument, nil, "invalid")
+	})
+	require.NotNil(t, err)
+	require.Equal(t, 1, attempts)
+
+	attempts = 0
+	err = policy.do(context.Background(), globalLogger{}, "register", func(context.Context) error {
+		attempts++
+		if attempts < 2 {
+			return retryable
+		}
+		return nil
+	})
+	require.Nil(t, err)
+	require.Equal(t, 2, attempts)
+}
+
+func TestRetryPolicyDeadline(t *testing.T) {
+	policy := RetryPolicy{Deadline: 20 * time.Millisecond, InitialBackoff: time.Millisecond}
+	policy.fillDefaults()
+
+	retryable := model.NewSDKError(model.ErrCodeNetworkError, nil, "network")
+	err := policy.do(context.Background(), globalLogger{}, "register", func(ctx context.Context) error {
+		// the attempts are bounded by the deadline of the policy.
+		_, ok := ctx.Deadline()
+		require.True(t, ok)
+		<-ctx.Done()
+		return retryable
+	})
+	require.NotNil(t, err)
+}
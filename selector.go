@@ -0,0 +1,163 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/polarismesh/polaris-go/api"
+)
+
+// AddressSelector picks the local address registered for servers listening on
+// an empty or unspecified host.
+type AddressSelector interface {
+	Select() (string, error)
+}
+
+// AddressSelectorFunc adapts a function to AddressSelector.
+type AddressSelectorFunc func() (string, error)
+
+// Select implements the AddressSelector interface.
+func (f AddressSelectorFunc) Select() (string, error) {
+	return f()
+}
+
+// PreferenceAddressSelector selects the first non-loopback local address matching pref.
+func PreferenceAddressSelector(pref IPPreference) AddressSelector {
+	return AddressSelectorFunc(func() (string, error) {
+		return GetLocalIPAddress(pref)
+	})
+}
+
+// InterfaceAddressSelector selects an address of the named network interface, like "eth0".
+func InterfaceAddressSelector(name string, pref IPPreference) AddressSelector {
+	return AddressSelectorFunc(func() (string, error) {
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			return "", err
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return "", err
+		}
+		return selectIPAddress(addrs, pref, func(net.IP) bool { return true })
+	})
+}
+
+// CIDRAddressSelector selects a local address inside one of cidrs, like "10.0.0.0/8".
+func CIDRAddressSelector(cidrs []string, pref IPPreference) (AddressSelector, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+	return AddressSelectorFunc(func() (string, error) {
+		addrs, err := net.InterfaceAddrs()
+		if err != nil {
+			return "", err
+		}
+		return selectIPAddress(addrs, pref, func(ip net.IP) bool {
+			for _, ipNet := range nets {
+				if ipNet.Contains(ip) {
+					return true
+				}
+			}
+			return false
+		})
+	}), nil
+}
+
+// EnvAddressSelector selects the address held by the environment variable key, like "POD_IP".
+func EnvAddressSelector(key string) AddressSelector {
+	return AddressSelectorFunc(func() (string, error) {
+		value := strings.TrimSpace(os.Getenv(key))
+		if value == "" {
+			return "", fmt.Errorf("environment variable %s is empty", key)
+		}
+		if net.ParseIP(value) == nil {
+			return "", fmt.Errorf("environment variable %s=%q is not an ip address", key, value)
+		}
+		return value, nil
+	})
+}
+
+// RouteAddressSelector selects the local address used to reach the first
+// reachable of targets, in host:port form. No packet is sent.
+func RouteAddressSelector(targets ...string) AddressSelector {
+	return AddressSelectorFunc(func() (string, error) {
+		var lastErr error
+		for _, target := range targets {
+			conn, err := net.Dial("udp", target)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			localAddr := conn.LocalAddr().(*net.UDPAddr)
+			conn.Close()
+			return localAddr.IP.String(), nil
+		}
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no route target")
+		}
+		return "", lastErr
+	})
+}
+
+// PolarisRouteAddressSelector selects the local address used to reach the polaris servers of sdkCtx.
+func PolarisRouteAddressSelector(sdkCtx api.SDKContext) AddressSelector {
+	return RouteAddressSelector(sdkCtx.GetConfig().GetGlobal().GetServerConnector().GetAddresses()...)
+}
+
+// ChainAddressSelector returns the address of the first selector that succeeds.
+func ChainAddressSelector(selectors ...AddressSelector) AddressSelector {
+	return AddressSelectorFunc(func() (string, error) {
+		errs := make([]string, 0, len(selectors))
+		for _, selector := range selectors {
+			addr, err := selector.Select()
+			if err == nil {
+				return addr, nil
+			}
+			errs = append(errs, err.Error())
+		}
+		return "", fmt.Errorf("no address selected: %s", strings.Join(errs, "; "))
+	})
+}
+
+// selectIPAddress picks among the non-loopback addrs accepted by match according to pref.
+func selectIPAddress(addrs []net.Addr, pref IPPreference, match func(net.IP) bool) (string, error) {
+	var ipv4, ipv6 string
+	for _, addr := range addrs {
+		ipNet, isIpNet := addr.(*net.IPNet)
+		if !isIpNet || ipNet.IP.IsLoopback() || !match(ipNet.IP) {
+			continue
+		}
+		if ip := ipNet.IP.To4(); ip != nil {
+			if ipv4 == "" {
+				ipv4 = ip.String()
+			}
+		} else if ipNet.IP.IsGlobalUnicast() && ipv6 == "" {
+			ipv6 = ipNet.IP.String()
+		}
+	}
+	return pickIPAddress(ipv4, ipv6, pref)
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectIPAddress(t *testing.T) {
+	var addrs []net.Addr
+	for _, cidr := range []string{"127.0.0.1/8", "172.17.0.1/16", "10.0.0.5/8", "fd00::5/64"} {
+		ip, ipNet, err := net.ParseCIDR(cidr)
+		require.Nil(t, err)
+		ipNet.IP = ip
+		addrs = append(addrs, ipNet)
+	}
+	_, allow, _ := net.ParseCIDR("10.0.0.0/8")
+
+	addr, err := selectIPAddress(addrs, PreferIPv4, func(net.IP) bool { return true })
+	require.Nil(t, err)
+	require.Equal(t, "172.17.0.1", addr)
+	addr, err = selectIPAddress(addrs, PreferIPv4, allow.Contains)
+	require.Nil(t, err)
+	require.Equal(t, "10.0.0.5", addr)
+	addr, err = selectIPAddress(addrs, PreferIPv6, func(net.IP) bool { return true })
+	require.Nil(t, err)
+	require.Equal(t, "fd00::5", addr)
+}
+
+func TestChainAddressSelector(t *testing.T) {
+	const key = "REGISTRY_POLARIS_TEST_POD_IP"
+	os.Unsetenv(key)
+	selector := ChainAddressSelector(EnvAddressSelector(key), AddressSelectorFunc(func() (string, error) {
+		return "10.0.0.6", nil
+	}))
+	addr, err := selector.Select()
+	require.Nil(t, err)
+	require.Equal(t, "10.0.0.6", addr)
+
+	os.Setenv(key, "10.0.0.7")
+	defer os.Unsetenv(key)
+	addr, err = selector.Select()
+	require.Nil(t, err)
+	require.Equal(t, "10.0.0.7", addr)
+}
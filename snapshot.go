@@ -0,0 +1,233 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/discovery"
+	"github.com/polarismesh/polaris-go/pkg/model"
+)
+
+const defaultSnapshotDir = "./polaris/snapshot"
+
+// SnapshotConfig persists the last resolved instances of every description, so that
+// a client can start, and keep working, while polaris is unreachable.
+type SnapshotConfig struct {
+	// Dir holds one snapshot file per description, ./polaris/snapshot by default.
+	Dir string
+	// MaxStaleness is the age beyond which a snapshot is not used anymore, zero means no limit.
+	MaxStaleness time.Duration
+}
+
+func (c *SnapshotConfig) fillDefaults() {
+	if c.Dir == "" {
+		c.Dir = defaultSnapshotDir
+	}
+}
+
+// Snapshot is the persisted content of a resolution.
+type Snapshot struct {
+	Description string `json:"description"`
+	// SavedAt is the time polaris last returned these instances.
+	SavedAt   time.Time          `json:"saved_at"`
+	Instances []SnapshotInstance `json:"instances"`
+}
+
+// SnapshotInstance is a persisted Kitex instance.
+type SnapshotInstance struct {
+	Network string            `json:"network"`
+	Address string            `json:"address"`
+	Weight  int               `json:"weight"`
+	Tags    map[string]string `json:"tags,omitempty"`
+}
+
+// Age returns how long ago the snapshot was saved.
+func (s *Snapshot) Age() time.Duration {
+	return time.Since(s.SavedAt)
+}
+
+// Result converts the snapshot to a Kitex discovery result.
+func (s *Snapshot) Result() discovery.Result {
+	instances := make([]discovery.Instance, 0, len(s.Instances))
+	for _, ins := range s.Instances {
+		instances = append(instances, discovery.NewInstance(ins.Network, ins.Address, ins.Weight, ins.Tags))
+	}
+	return discovery.Result{
+		Cacheable: true,
+		CacheKey:  s.Description,
+		Instances: instances,
+	}
+}
+
+// LoadSnapshot reads the snapshot of desc stored in dir.
+func LoadSnapshot(dir, desc string) (*Snapshot, error) {
+	data, err := ioutil.ReadFile(snapshotPath(dir, desc))
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &Snapshot{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// save replaces the snapshot of desc with instances.
+func (c *SnapshotConfig) save(desc string, instances []model.Instance) error {
+	snapshot := &Snapshot{
+		Description: desc,
+		SavedAt:     time.Now(),
+		Instances:   make([]SnapshotInstance, 0, len(instances)),
+	}
+	for _, instance := range instances {
+		ins := ChangePolarisInstanceToKitex(instance)
+		snapshot.Instances = append(snapshot.Instances, SnapshotInstance{
+			Network: ins.Address().Network(),
+			Address: ins.Address().String(),
+			Weight:  ins.Weight(),
+			Tags:    instanceTags(instance),
+		})
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return err
+	}
+	// write then rename, so that readers never see a partial snapshot.
+	path := snapshotPath(c.Dir, desc)
+	tmp, err := ioutil.TempFile(c.Dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// snapshotWriter saves the snapshots of a resolver in the background, only when the
+// revision of the instances changes or when the snapshot is getting stale.
+type snapshotWriter struct {
+	cfg    *SnapshotConfig
+	logger Logger
+
+	lock   sync.Mutex
+	states map[string]*snapshotState
+}
+
+// snapshotState is the snapshot of a description, saved and waiting to be saved.
+type snapshotState struct {
+	revision string
+	savedAt  time.Time
+
+	pending         []model.Instance
+	pendingRevision string
+	writing         bool
+}
+
+func newSnapshotWriter(cfg *SnapshotConfig, logger Logger) *snapshotWriter {
+	return &snapshotWriter{cfg: cfg, logger: logger, states: make(map[string]*snapshotState)}
+}
+
+// update schedules the save of the instances of desc, at revision, unless they are already saved.
+func (w *snapshotWriter) update(desc, revision string, instances []model.Instance) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	state, ok := w.states[desc]
+	if !ok {
+		state = &snapshotState{}
+		w.states[desc] = state
+	}
+	if revision != "" {
+		if state.pending != nil && revision == state.pendingRevision {
+			return
+		}
+		// the snapshot is saved again once half as old as MaxStaleness, so that it is not
+		// deemed stale while polaris keeps returning the same instances.
+		fresh := w.cfg.MaxStaleness <= 0 || time.Since(state.savedAt) < w.cfg.MaxStaleness/2
+		if state.pending == nil && revision == state.revision && fresh {
+			return
+		}
+	}
+	state.pending, state.pendingRevision = instances, revision
+	if !state.writing {
+		state.writing = true
+		go w.write(desc, state)
+	}
+}
+
+// write saves the pending instances of desc until there is none.
+func (w *snapshotWriter) write(desc string, state *snapshotState) {
+	for {
+		w.lock.Lock()
+		instances, revision := state.pending, state.pendingRevision
+		state.pending = nil
+		if instances == nil {
+			state.writing = false
+			w.lock.Unlock()
+			return
+		}
+		w.lock.Unlock()
+
+		err := w.cfg.save(desc, instances)
+		if err != nil {
+			w.logger.Warn("fail to save snapshot", "desc", desc, "err", err)
+			continue
+		}
+		w.lock.Lock()
+		state.revision, state.savedAt = revision, time.Now()
+		w.lock.Unlock()
+	}
+}
+
+// fallback returns the snapshot of desc when there is a fresh enough one.
+func (c *SnapshotConfig) fallback(logger Logger, desc string) (discovery.Result, bool) {
+	snapshot, err := LoadSnapshot(c.Dir, desc)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warn("fail to load snapshot", "desc", desc, "err", err)
+		}
+		return discovery.Result{}, false
+	}
+	age := snapshot.Age()
+	if c.MaxStaleness > 0 && age > c.MaxStaleness {
+		logger.Warn("snapshot is too stale to be used", "desc", desc, "age", age)
+		return discovery.Result{}, false
+	}
+	logger.Warn("polaris is unavailable, use snapshot", "desc", desc, "age", age)
+	return snapshot.Result(), true
+}
+
+func snapshotPath(dir, desc string) string {
+	return filepath.Join(dir, url.QueryEscape(desc)+".json")
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/registry"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"github.com/cloudwego/kitex/pkg/utils"
+	"github.com/kitex-contrib/registry-polaris/polaristest"
+	"github.com/polarismesh/polaris-go/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolverSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	server := polaristest.NewServer()
+	rg := NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI())
+	rs := NewPolarisResolverByAPI(server.ProviderAPI(), server.ConsumerAPI(), WithSnapshot(SnapshotConfig{Dir: dir}))
+	info := &registry.Info{
+		ServiceName: serviceName,
+		Addr:        utils.NewNetAddr("tcp", "127.0.0.1:6666"),
+		Weight:      30,
+		Tags:        map[string]string{"env": "test"},
+	}
+	require.Nil(t, rg.Register(info))
+	defer rg.Deregister(info)
+
+	desc := rs.Target(context.TODO(), rpcinfo.NewEndpointInfo(serviceName, "", nil, nil))
+	resolved, err := rs.Resolve(context.TODO(), desc)
+	require.Nil(t, err)
+	// the snapshot is saved in the background.
+	var snapshot *Snapshot
+	require.Eventually(t, func() bool {
+		snapshot, err = LoadSnapshot(dir, desc)
+		return err == nil
+	}, time.Second, time.Millisecond)
+	require.Equal(t, desc, snapshot.Description)
+	require.Less(t, snapshot.Age(), time.Minute)
+
+	// polaris is unreachable while a new client starts.
+	down := polaristest.NewServer()
+	down.InjectError(polaristest.OpGetInstances, model.NewSDKError(model.ErrCodeNetworkError, nil, "network"), 0)
+	rs = NewPolarisResolverByAPI(down.ProviderAPI(), down.ConsumerAPI(), WithSnapshot(SnapshotConfig{Dir: dir}))
+	result, err := rs.Resolve(context.TODO(), desc)
+	require.Nil(t, err)
+	require.Equal(t, resolved, result)
+	env, _ := result.Instances[0].Tag("env")
+	require.Equal(t, "test", env)
+
+	rs = NewPolarisResolverByAPI(down.ProviderAPI(), down.ConsumerAPI(),
+		WithSnapshot(SnapshotConfig{Dir: dir, MaxStaleness: time.Nanosecond}))
+	_, err = rs.Resolve(context.TODO(), desc)
+	require.NotNil(t, err)
+
+	rs = NewPolarisResolverByAPI(down.ProviderAPI(), down.ConsumerAPI(), WithSnapshot(SnapshotConfig{Dir: t.TempDir()}))
+	_, err = rs.Resolve(context.TODO(), desc)
+	require.NotNil(t, err)
+}
+
+func TestSnapshotSavedOnRevisionChange(t *testing.T) {
+	dir := t.TempDir()
+	w := newSnapshotWriter(&SnapshotConfig{Dir: dir}, globalLogger{})
+	desc := polarisDefaultNamespace + ":" + serviceName
+	instances := []model.Instance{&polaristest.Instance{Host: "127.0.0.1", Port: 6666, Weight: 10}}
+	saved := func() bool {
+		w.lock.Lock()
+		defer w.lock.Unlock()
+		state := w.states[desc]
+		return state != nil && !state.writing
+	}
+	savedAt := func() time.Time {
+		snapshot, err := LoadSnapshot(dir, desc)
+		require.Nil(t, err)
+		return snapshot.SavedAt
+	}
+
+	w.update(desc, "1", instances)
+	require.Eventually(t, saved, time.Second, time.Millisecond)
+	first := savedAt()
+
+	// the revision is unchanged, nothing is written.
+	w.update(desc, "1", instances)
+	require.True(t, saved())
+	require.Equal(t, first, savedAt())
+
+	w.update(desc, "2", instances)
+	require.Eventually(t, func() bool { return saved() && savedAt().After(first) }, time.Second, time.Millisecond)
+}
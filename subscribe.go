@@ -0,0 +1,458 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/discovery"
+	"github.com/polarismesh/polaris-go/api"
+	"github.com/polarismesh/polaris-go/pkg/model"
+)
+
+// SubscribeMode decides what the changes delivered to a subscription hold.
+type SubscribeMode int
+
+const (
+	// SubscribeIncremental delivers the instances added, updated and removed by each change,
+	// the first change adds every instance. It is the default.
+	SubscribeIncremental SubscribeMode = iota
+	// SubscribeFull only delivers the instance list in the Result of each change.
+	SubscribeFull
+)
+
+// ChangeHandler handles the changes of a subscription. The handlers of the subscriptions of a description
+// are called one after the other from a single goroutine, so they should return quickly.
+// Result always holds every instance of the service.
+type ChangeHandler func(change discovery.Change)
+
+// SubscribeOption customizes a subscription.
+type SubscribeOption func(o *subscribeOptions)
+
+type subscribeOptions struct {
+	mode SubscribeMode
+}
+
+// WithSubscribeMode sets the mode of the subscription, SubscribeIncremental by default.
+func WithSubscribeMode(mode SubscribeMode) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.mode = mode
+	}
+}
+
+// Subscription is the handle of a subscription.
+type Subscription interface {
+	// Unsubscribe stops the deliveries, it does not wait for a running handler call and can be called from it.
+	Unsubscribe()
+}
+
+// Subscriber lets application code follow the instances of a service, the resolvers created by
+// NewPolarisResolver and its variants implement it.
+//
+// The subscriptions and the Watcher calls of a resolver to a description share one polaris watch.
+// polaris-go delivers the events of a service to a single channel, shared with the other resolvers of
+// the SDK context, so the events only trigger a resync of the instances, which also runs periodically.
+type Subscriber interface {
+	Subscribe(desc string, handler ChangeHandler, opts ...SubscribeOption) (Subscription, error)
+}
+
+// watchResyncInterval is the interval between two resyncs of a watch without polaris events.
+var watchResyncInterval = 30 * time.Second
+
+// subscription is a handler subscribed to a serviceWatch.
+type subscription struct {
+	watch   *serviceWatch
+	mode    SubscribeMode
+	handler ChangeHandler
+	// initial tells whether the first change, adding every instance, is delivered.
+	initial bool
+	closed  int32
+	once    sync.Once
+}
+
+// Unsubscribe implements the Subscription interface.
+func (s *subscription) Unsubscribe() {
+	s.once.Do(func() {
+		atomic.StoreInt32(&s.closed, 1)
+		s.watch.resolver.releaseWatch(s.watch)
+	})
+}
+
+// serviceWatch feeds the subscriptions of a description from a polaris watch.
+type serviceWatch struct {
+	resolver *polarisResolver
+	desc     string
+	cancel   context.CancelFunc
+	// interval is the interval between two resyncs without polaris events.
+	interval time.Duration
+	// refs is the number of subscriptions, guarded by polarisResolver.lock.
+	refs int
+
+	lock sync.Mutex
+	// pending are the subscriptions waiting for their first change.
+	pending []*subscription
+	wakeup  chan struct{}
+
+	// instances, revision and subscriptions are only used by the run goroutine.
+	instances     map[string]model.Instance
+	revision      string
+	subscriptions []*subscription
+}
+
+// Subscribe implements the Subscriber interface.
+func (polaris *polarisResolver) Subscribe(desc string, handler ChangeHandler, opts ...SubscribeOption) (Subscription, error) {
+	o := &subscribeOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	w, err := polaris.acquireWatch(context.Background(), desc)
+	if err != nil {
+		return nil, err
+	}
+	sub := &subscription{watch: w, mode: o.mode, handler: handler, initial: true}
+	w.join(sub)
+	return sub, nil
+}
+
+// join adds sub to the subscriptions of w.
+func (w *serviceWatch) join(sub *subscription) {
+	w.lock.Lock()
+	w.pending = append(w.pending, sub)
+	w.lock.Unlock()
+	select {
+	case w.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// acquireWatch returns the watch of desc, starting it within ctx when there is none.
+func (polaris *polarisResolver) acquireWatch(ctx context.Context, desc string) (*serviceWatch, error) {
+	polaris.lock.Lock()
+	if w, ok := polaris.subscriptions[desc]; ok {
+		w.refs++
+		polaris.lock.Unlock()
+		return w, nil
+	}
+	polaris.lock.Unlock()
+
+	namespace, serviceName := SplitDescription(desc)
+	watchReq := api.WatchServiceRequest{}
+	watchReq.Key = model.ServiceKey{Namespace: namespace, Service: serviceName}
+	_, span := polaris.opts.tracer.start(ctx, "WatchService", namespace, serviceName)
+	var watchRsp *model.WatchServiceResponse
+	err := callContext(ctx, func() (err error) {
+		watchRsp, err = polaris.consumer.WatchService(&watchReq)
+		return err
+	})
+	if err == nil {
+		span.SetAttributes(attrInstanceCount.Int(len(watchRsp.GetAllInstancesResp.GetInstances())))
+	}
+	endSpan(span, err)
+	if err != nil {
+		if ctx.Err() == nil {
+			polaris.opts.logger.Error("fail to watch service", "namespace", namespace, "service", serviceName, "err", err)
+		}
+		return nil, err
+	}
+
+	polaris.lock.Lock()
+	defer polaris.lock.Unlock()
+	if w, ok := polaris.subscriptions[desc]; ok {
+		// subscribed concurrently, polaris-go shares the event channel of the service.
+		w.refs++
+		return w, nil
+	}
+	watchCtx, cancel := context.WithCancel(context.Background())
+	w := &serviceWatch{
+		resolver:  polaris,
+		desc:      desc,
+		cancel:    cancel,
+		interval:  watchResyncInterval,
+		refs:      1,
+		wakeup:    make(chan struct{}, 1),
+		instances: make(map[string]model.Instance),
+		revision:  watchRsp.GetAllInstancesResp.GetRevision(),
+	}
+	for _, ins := range watchRsp.GetAllInstancesResp.GetInstances() {
+		w.instances[instanceAddr(ins)] = ins
+	}
+	polaris.subscriptions[desc] = w
+	polaris.watchers[desc]++
+	go w.run(watchCtx, watchRsp.EventChannel)
+	return w, nil
+}
+
+// releaseWatch stops the watch once its last subscription is gone.
+func (polaris *polarisResolver) releaseWatch(w *serviceWatch) {
+	polaris.lock.Lock()
+	defer polaris.lock.Unlock()
+	w.refs--
+	if w.refs > 0 {
+		return
+	}
+	w.cancel()
+	delete(polaris.subscriptions, w.desc)
+	polaris.watchers[w.desc]--
+	if polaris.watchers[w.desc] <= 0 {
+		delete(polaris.watchers, w.desc)
+	}
+}
+
+// run delivers the changes of the instances, resynced on the polaris events and periodically, until ctx is done.
+// The events are not applied: the channel of a service is shared by the watches of the SDK context, so some
+// events are taken by others, and those queued before the watch started are outdated.
+func (w *serviceWatch) run(ctx context.Context, events <-chan model.SubScribeEvent) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.wakeup:
+			w.lock.Lock()
+			pending := w.pending
+			w.pending = nil
+			w.lock.Unlock()
+			added := make([]discovery.Instance, 0, len(w.instances))
+			for _, ins := range w.instances {
+				added = append(added, ChangePolarisInstanceToKitex(ins))
+			}
+			sortInstances(added)
+			for _, sub := range pending {
+				w.subscriptions = append(w.subscriptions, sub)
+				if sub.initial {
+					w.deliver(sub, discovery.Change{Result: w.result(), Added: added})
+				}
+			}
+		case _, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			w.resync(ctx)
+		case <-ticker.C:
+			w.resync(ctx)
+		}
+	}
+}
+
+// resync gets the instances from polaris and delivers the change from the former ones, if any.
+func (w *serviceWatch) resync(ctx context.Context) {
+	polaris := w.resolver
+	namespace, serviceName := SplitDescription(w.desc)
+	_, span := polaris.opts.tracer.start(ctx, "GetAllInstances", namespace, serviceName)
+	getAll := &api.GetAllInstancesRequest{}
+	getAll.Namespace = namespace
+	getAll.Service = serviceName
+	var resp *model.InstancesResponse
+	err := callContext(ctx, func() (err error) {
+		resp, err = polaris.consumer.GetAllInstances(getAll)
+		return err
+	})
+	if err == nil {
+		span.SetAttributes(attrInstanceCount.Int(len(resp.GetInstances())))
+	}
+	endSpan(span, err)
+	if err != nil {
+		if ctx.Err() == nil {
+			polaris.opts.logger.Warn("fail to resync watched service", "namespace", namespace, "service", serviceName, "err", err)
+		}
+		return
+	}
+	if resp.GetRevision() != "" && resp.GetRevision() == w.revision {
+		return
+	}
+	w.revision = resp.GetRevision()
+	change := w.apply(resp.GetInstances())
+	if len(change.Added)+len(change.Updated)+len(change.Removed) == 0 {
+		return
+	}
+	live := w.subscriptions[:0]
+	for _, sub := range w.subscriptions {
+		if atomic.LoadInt32(&sub.closed) == 0 {
+			live = append(live, sub)
+			w.deliver(sub, change)
+		}
+	}
+	w.subscriptions = live
+}
+
+// apply replaces the instances with instances and returns the change it makes.
+func (w *serviceWatch) apply(instances []model.Instance) discovery.Change {
+	var change discovery.Change
+	next := make(map[string]model.Instance, len(instances))
+	for _, ins := range instances {
+		addr := instanceAddr(ins)
+		next[addr] = ins
+		former, ok := w.instances[addr]
+		switch {
+		case !ok:
+			change.Added = append(change.Added, ChangePolarisInstanceToKitex(ins))
+		case former.GetProtocol() != ins.GetProtocol() || former.GetWeight() != ins.GetWeight() ||
+			stateOf(former).updated(stateOf(ins)):
+			change.Updated = append(change.Updated, ChangePolarisInstanceToKitex(ins))
+		}
+	}
+	for addr, ins := range w.instances {
+		if _, ok := next[addr]; !ok {
+			change.Removed = append(change.Removed, ChangePolarisInstanceToKitex(ins))
+		}
+	}
+	w.instances = next
+	sortInstances(change.Added)
+	sortInstances(change.Updated)
+	sortInstances(change.Removed)
+	change.Result = w.result()
+	return change
+}
+
+// result returns the current instances.
+func (w *serviceWatch) result() discovery.Result {
+	instances := make([]discovery.Instance, 0, len(w.instances))
+	for _, ins := range w.instances {
+		instances = append(instances, ChangePolarisInstanceToKitex(ins))
+	}
+	sortInstances(instances)
+	return discovery.Result{
+		Cacheable: true,
+		CacheKey:  w.desc,
+		Instances: instances,
+	}
+}
+
+// changeQueue merges the changes of a watch until they are taken.
+type changeQueue struct {
+	lock    sync.Mutex
+	change  discovery.Change
+	queued  bool
+	changed chan struct{}
+}
+
+func newChangeQueue() *changeQueue {
+	return &changeQueue{changed: make(chan struct{}, 1)}
+}
+
+// push queues change, merged with the queued one.
+func (q *changeQueue) push(change discovery.Change) {
+	q.lock.Lock()
+	if q.queued {
+		change = mergeChanges(q.change, change)
+	}
+	q.change, q.queued = change, true
+	q.lock.Unlock()
+	select {
+	case q.changed <- struct{}{}:
+	default:
+	}
+}
+
+// next takes the queued change, waiting for one until ctx is done.
+func (q *changeQueue) next(ctx context.Context) (discovery.Change, bool) {
+	for {
+		q.lock.Lock()
+		if q.queued {
+			change := q.change
+			q.change, q.queued = discovery.Change{}, false
+			q.lock.Unlock()
+			return change, true
+		}
+		q.lock.Unlock()
+		select {
+		case <-ctx.Done():
+			return discovery.Change{}, false
+		case <-q.changed:
+		}
+	}
+}
+
+const (
+	changeAdded = iota + 1
+	changeUpdated
+	changeRemoved
+)
+
+// mergeChanges returns the change made by former and then by next, with the Result of next.
+func mergeChanges(former, next discovery.Change) discovery.Change {
+	kinds := make(map[string]int)
+	instances := make(map[string]discovery.Instance)
+	add := func(kind int, list []discovery.Instance) {
+		for _, ins := range list {
+			addr := ins.Address().String()
+			merged := kind
+			switch former := kinds[addr]; {
+			case former == changeAdded && kind == changeRemoved:
+				delete(kinds, addr)
+				delete(instances, addr)
+				continue
+			case former == changeAdded:
+				merged = changeAdded
+			case former == changeRemoved && kind == changeAdded:
+				merged = changeUpdated
+			}
+			kinds[addr], instances[addr] = merged, ins
+		}
+	}
+	for _, change := range []discovery.Change{former, next} {
+		add(changeAdded, change.Added)
+		add(changeUpdated, change.Updated)
+		add(changeRemoved, change.Removed)
+	}
+	merged := discovery.Change{Result: next.Result}
+	for addr, kind := range kinds {
+		switch kind {
+		case changeAdded:
+			merged.Added = append(merged.Added, instances[addr])
+		case changeUpdated:
+			merged.Updated = append(merged.Updated, instances[addr])
+		case changeRemoved:
+			merged.Removed = append(merged.Removed, instances[addr])
+		}
+	}
+	sortInstances(merged.Added)
+	sortInstances(merged.Updated)
+	sortInstances(merged.Removed)
+	return merged
+}
+
+// deliver calls the handler of sub with change, according to its mode.
+func (w *serviceWatch) deliver(sub *subscription, change discovery.Change) {
+	if atomic.LoadInt32(&sub.closed) != 0 {
+		return
+	}
+	if sub.mode == SubscribeFull {
+		change = discovery.Change{Result: change.Result}
+	}
+	sub.handler(change)
+}
+
+// instanceAddr returns the address of a polaris instance.
+func instanceAddr(ins model.Instance) string {
+	return net.JoinHostPort(ins.GetHost(), strconv.Itoa(int(ins.GetPort())))
+}
+
+// sortInstances sorts instances by address.
+func sortInstances(instances []discovery.Instance) {
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].Address().String() < instances[j].Address().String()
+	})
+}
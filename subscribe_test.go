@@ -0,0 +1,228 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/discovery"
+	"github.com/cloudwego/kitex/pkg/registry"
+	"github.com/cloudwego/kitex/pkg/utils"
+	"github.com/kitex-contrib/registry-polaris/polaristest"
+	"github.com/polarismesh/polaris-go/api"
+	"github.com/polarismesh/polaris-go/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func addresses(instances []discovery.Instance) []string {
+	addrs := make([]string, 0, len(instances))
+	for _, ins := range instances {
+		addrs = append(addrs, ins.Address().String())
+	}
+	return addrs
+}
+
+func TestSubscribe(t *testing.T) {
+	server := polaristest.NewServer()
+	rg := NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI())
+	rs := NewPolarisResolverByAPI(server.ProviderAPI(), server.ConsumerAPI())
+	first := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+	second := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:7777")}
+	require.Nil(t, rg.Register(first))
+	defer rg.Deregister(first)
+
+	desc := polarisDefaultNamespace + ":" + serviceName
+	incremental, full := make(chan discovery.Change, 8), make(chan discovery.Change, 8)
+	subscriber := rs.(Subscriber)
+	incrementalSub, err := subscriber.Subscribe(desc, func(change discovery.Change) { incremental <- change })
+	require.Nil(t, err)
+	fullSub, err := subscriber.Subscribe(desc, func(change discovery.Change) { full <- change },
+		WithSubscribeMode(SubscribeFull))
+	require.Nil(t, err)
+	defer fullSub.Unsubscribe()
+	next := func(ch chan discovery.Change) discovery.Change {
+		select {
+		case change := <-ch:
+			return change
+		case <-time.After(time.Second):
+			require.FailNow(t, "no change")
+			return discovery.Change{}
+		}
+	}
+
+	// the first change holds the current instances.
+	change := next(incremental)
+	require.Equal(t, []string{"127.0.0.1:6666"}, addresses(change.Added))
+	require.Equal(t, []string{"127.0.0.1:6666"}, addresses(change.Result.Instances))
+	change = next(full)
+	require.Empty(t, change.Added)
+	require.Equal(t, []string{"127.0.0.1:6666"}, addresses(change.Result.Instances))
+
+	require.Nil(t, rg.Register(second))
+	change = next(incremental)
+	require.Equal(t, []string{"127.0.0.1:7777"}, addresses(change.Added))
+	require.Equal(t, []string{"127.0.0.1:6666", "127.0.0.1:7777"}, addresses(change.Result.Instances))
+	change = next(full)
+	require.Empty(t, change.Added)
+	require.Equal(t, []string{"127.0.0.1:6666", "127.0.0.1:7777"}, addresses(change.Result.Instances))
+
+	// the subscriptions share one watch, it keeps running for the remaining one.
+	require.Equal(t, 1, server.Calls(polaristest.OpWatchService))
+	incrementalSub.Unsubscribe()
+	incrementalSub.Unsubscribe()
+	require.Nil(t, rg.Deregister(second))
+	change = next(full)
+	require.Equal(t, []string{"127.0.0.1:6666"}, addresses(change.Result.Instances))
+	select {
+	case change := <-incremental:
+		require.FailNow(t, "change after Unsubscribe", "%v", change)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSubscribeUnknownService(t *testing.T) {
+	server := polaristest.NewServer()
+	rs := NewPolarisResolverByAPI(server.ProviderAPI(), server.ConsumerAPI())
+	_, err := rs.(Subscriber).Subscribe(polarisDefaultNamespace+":"+serviceName, func(discovery.Change) {})
+	require.NotNil(t, err)
+}
+
+func TestSubscribeWithWatcher(t *testing.T) {
+	server := polaristest.NewServer()
+	rg := NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI())
+	rs := NewPolarisResolverByAPI(server.ProviderAPI(), server.ConsumerAPI())
+	first := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+	second := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:7777")}
+	require.Nil(t, rg.Register(first))
+	defer rg.Deregister(first)
+
+	desc := polarisDefaultNamespace + ":" + serviceName
+	changes := make(chan discovery.Change, 8)
+	sub, err := rs.(Subscriber).Subscribe(desc, func(change discovery.Change) { changes <- change })
+	require.Nil(t, err)
+	defer sub.Unsubscribe()
+	<-changes
+	// the first call starts queuing the changes for the next ones.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	change, err := rs.Watcher(ctx, desc)
+	cancel()
+	require.Nil(t, err)
+	require.Empty(t, change.Added)
+
+	require.Nil(t, rg.Register(second))
+	defer rg.Deregister(second)
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	change, err = rs.Watcher(ctx, desc)
+	require.Nil(t, err)
+	require.Equal(t, []string{"127.0.0.1:7777"}, addresses(change.Added))
+	require.Equal(t, []string{"127.0.0.1:6666", "127.0.0.1:7777"}, addresses(change.Result.Instances))
+	select {
+	case change := <-changes:
+		require.Equal(t, []string{"127.0.0.1:7777"}, addresses(change.Added))
+	case <-time.After(time.Second):
+		require.FailNow(t, "no change")
+	}
+	require.Equal(t, 1, server.Calls(polaristest.OpWatchService))
+}
+
+func TestResubscribe(t *testing.T) {
+	server := polaristest.NewServer()
+	rg := NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI())
+	rs := NewPolarisResolverByAPI(server.ProviderAPI(), server.ConsumerAPI())
+	first := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+	second := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:7777")}
+	require.Nil(t, rg.Register(first))
+	defer rg.Deregister(first)
+
+	desc := polarisDefaultNamespace + ":" + serviceName
+	changes := make(chan discovery.Change, 8)
+	handler := func(change discovery.Change) { changes <- change }
+	sub, err := rs.(Subscriber).Subscribe(desc, handler)
+	require.Nil(t, err)
+	<-changes
+	sub.Unsubscribe()
+
+	// the event queued without watch is not applied on top of the instances of the new watch.
+	require.Nil(t, rg.Register(second))
+	defer rg.Deregister(second)
+	sub, err = rs.(Subscriber).Subscribe(desc, handler)
+	require.Nil(t, err)
+	defer sub.Unsubscribe()
+	select {
+	case change := <-changes:
+		require.Equal(t, []string{"127.0.0.1:6666", "127.0.0.1:7777"}, addresses(change.Added))
+	case <-time.After(time.Second):
+		require.FailNow(t, "no change")
+	}
+	select {
+	case change := <-changes:
+		require.FailNow(t, "replayed change", "%v", change)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// eventlessConsumer stands for a consumer whose events are taken by other watches of the SDK context.
+type eventlessConsumer struct {
+	api.ConsumerAPI
+}
+
+func (c eventlessConsumer) WatchService(req *api.WatchServiceRequest) (*model.WatchServiceResponse, error) {
+	resp, err := c.ConsumerAPI.WatchService(req)
+	if err != nil {
+		return nil, err
+	}
+	return &model.WatchServiceResponse{
+		EventChannel:        make(chan model.SubScribeEvent),
+		GetAllInstancesResp: resp.GetAllInstancesResp,
+	}, nil
+}
+
+func TestSubscribeResync(t *testing.T) {
+	defer func(interval time.Duration) { watchResyncInterval = interval }(watchResyncInterval)
+	watchResyncInterval = 10 * time.Millisecond
+	server := polaristest.NewServer()
+	rg := NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI())
+	rs := NewPolarisResolverByAPI(server.ProviderAPI(), eventlessConsumer{server.ConsumerAPI()})
+	first := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+	require.Nil(t, rg.Register(first))
+	defer rg.Deregister(first)
+
+	desc := polarisDefaultNamespace + ":" + serviceName
+	changes := make(chan discovery.Change, 8)
+	sub, err := rs.(Subscriber).Subscribe(desc, func(change discovery.Change) { changes <- change })
+	require.Nil(t, err)
+	defer sub.Unsubscribe()
+	<-changes
+
+	require.True(t, server.UpdateInstance(polarisDefaultNamespace, serviceName, "127.0.0.1", 6666,
+		func(ins *polaristest.Instance) { ins.Isolated = true }))
+	select {
+	case change := <-changes:
+		require.Equal(t, []string{"127.0.0.1:6666"}, addresses(change.Updated))
+	case <-time.After(time.Second):
+		require.FailNow(t, "no change")
+	}
+	// the resyncs without change are not delivered.
+	select {
+	case change := <-changes:
+		require.FailNow(t, "change without update", "%v", change)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
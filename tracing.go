@@ -0,0 +1,127 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"context"
+	"errors"
+
+	"github.com/polarismesh/polaris-go/pkg/model"
+)
+
+// The attributes set on the spans of polaris calls.
+const (
+	AttrNamespace     = "polaris.namespace"
+	AttrService       = "polaris.service"
+	AttrInstanceHost  = "polaris.instance.host"
+	AttrInstancePort  = "polaris.instance.port"
+	AttrInstanceCount = "polaris.instance_count"
+	AttrErrorCode     = "polaris.error_code"
+)
+
+// Tracer creates the spans of polaris calls, like the OpenTelemetry one of the
+// github.com/kitex-contrib/registry-polaris/tracing/otel module.
+type Tracer interface {
+	// StartSpan starts the span of the polaris call op, like "Register", on a service.
+	// The span is expected to carry the AttrNamespace and AttrService attributes.
+	StartSpan(ctx context.Context, op, namespace, service string) (context.Context, Span)
+}
+
+// Span is the span of a polaris call.
+type Span interface {
+	// SetAttribute sets an attribute of the span, value is a string or an int.
+	SetAttribute(key string, value interface{})
+	// End ends the span, err is the error of the call, nil when it succeeded.
+	End(err error)
+}
+
+// attrKey is the key of a span attribute.
+type attrKey string
+
+// span attributes.
+const (
+	attrHost          = attrKey(AttrInstanceHost)
+	attrPort          = attrKey(AttrInstancePort)
+	attrInstanceCount = attrKey(AttrInstanceCount)
+)
+
+// attribute is a span attribute.
+type attribute struct {
+	key   string
+	value interface{}
+}
+
+// String returns the attribute k=v.
+func (k attrKey) String(v string) attribute {
+	return attribute{key: string(k), value: v}
+}
+
+// Int returns the attribute k=v.
+func (k attrKey) Int(v int) attribute {
+	return attribute{key: string(k), value: v}
+}
+
+// tracer creates the spans of polaris calls, a nil *tracer creates no span.
+type tracer struct {
+	tracer Tracer
+}
+
+func newTracer(t Tracer) *tracer {
+	if t == nil {
+		return nil
+	}
+	return &tracer{tracer: t}
+}
+
+// span is the span of a polaris call, a nil *span records nothing.
+type span struct {
+	span Span
+}
+
+// start starts the span of the polaris call op, like "Register", on a service.
+func (t *tracer) start(ctx context.Context, op, namespace, service string, attrs ...attribute) (context.Context, *span) {
+	if t == nil {
+		return ctx, nil
+	}
+	ctx, s := t.tracer.StartSpan(ctx, op, namespace, service)
+	for _, attr := range attrs {
+		s.SetAttribute(attr.key, attr.value)
+	}
+	return ctx, &span{span: s}
+}
+
+// SetAttributes sets attributes of the span.
+func (s *span) SetAttributes(attrs ...attribute) {
+	if s == nil {
+		return
+	}
+	for _, attr := range attrs {
+		s.span.SetAttribute(attr.key, attr.value)
+	}
+}
+
+// endSpan ends span, recording err and its polaris error code.
+func endSpan(s *span, err error) {
+	if s == nil {
+		return
+	}
+	var sdkErr model.SDKError
+	if errors.As(err, &sdkErr) {
+		s.span.SetAttribute(AttrErrorCode, int(sdkErr.ErrorCode()))
+	}
+	s.span.End(err)
+}
@@ -0,0 +1,13 @@
+module github.com/kitex-contrib/registry-polaris/tracing/otel
+
+go 1.16
+
+require (
+	github.com/cloudwego/kitex v0.1.3
+	github.com/kitex-contrib/registry-polaris v0.0.0-20261019175326-f1230b4ccce4
+	github.com/polarismesh/polaris-go v1.0.1
+	github.com/stretchr/testify v1.7.0
+	go.opentelemetry.io/otel v1.3.0
+	go.opentelemetry.io/otel/sdk v1.3.0
+	go.opentelemetry.io/otel/trace v1.3.0
+)
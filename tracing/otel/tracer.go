@@ -0,0 +1,78 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package otel creates the spans of the polaris calls of the registries and resolvers with OpenTelemetry.
+package otel
+
+import (
+	"context"
+	"fmt"
+
+	polaris "github.com/kitex-contrib/registry-polaris"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/kitex-contrib/registry-polaris"
+
+// tracer creates OpenTelemetry spans.
+type tracer struct {
+	tracer trace.Tracer
+}
+
+// NewTracer creates a tracer creating the spans from tp, given to the registries and resolvers
+// with polaris.WithRegistryTracing and polaris.WithResolverTracing.
+func NewTracer(tp trace.TracerProvider) polaris.Tracer {
+	return &tracer{tracer: tp.Tracer(tracerName)}
+}
+
+// StartSpan implements the polaris.Tracer interface.
+func (t *tracer) StartSpan(ctx context.Context, op, namespace, service string) (context.Context, polaris.Span) {
+	ctx, s := t.tracer.Start(ctx, "polaris."+op, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String(polaris.AttrNamespace, namespace), attribute.String(polaris.AttrService, service)))
+	return ctx, &span{span: s}
+}
+
+// span is an OpenTelemetry span.
+type span struct {
+	span trace.Span
+}
+
+// SetAttribute implements the polaris.Span interface.
+func (s *span) SetAttribute(key string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		s.span.SetAttributes(attribute.String(key, v))
+	case int:
+		s.span.SetAttributes(attribute.Int(key, v))
+	case int64:
+		s.span.SetAttributes(attribute.Int64(key, v))
+	case bool:
+		s.span.SetAttributes(attribute.Bool(key, v))
+	default:
+		s.span.SetAttributes(attribute.String(key, fmt.Sprint(v)))
+	}
+}
+
+// End implements the polaris.Span interface.
+func (s *span) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package otel
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudwego/kitex/pkg/registry"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"github.com/cloudwego/kitex/pkg/utils"
+	polaris "github.com/kitex-contrib/registry-polaris"
+	"github.com/kitex-contrib/registry-polaris/polaristest"
+	"github.com/polarismesh/polaris-go/pkg/model"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const (
+	namespace   = "default"
+	serviceName = "registry-test"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	server := polaristest.NewServer()
+	rg := polaris.NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI(), polaris.WithRegistryTracing(NewTracer(tp)))
+	rs := polaris.NewPolarisResolverByAPI(server.ProviderAPI(), server.ConsumerAPI(), polaris.WithResolverTracing(NewTracer(tp)))
+	info := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+
+	require.Nil(t, rg.Register(info))
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "call")
+	desc := rs.Target(ctx, rpcinfo.NewEndpointInfo(serviceName, "", nil, nil))
+	_, err := rs.Resolve(ctx, desc)
+	require.Nil(t, err)
+	parent.End()
+	server.InjectError(polaristest.OpDeregister, model.NewSDKError(model.ErrCodeNetworkError, nil, "network"), 1)
+	require.NotNil(t, rg.Deregister(info))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 4)
+	register, resolve, deregister := spans[0], spans[1], spans[3]
+	require.Equal(t, "polaris.Register", register.Name())
+	require.Contains(t, register.Attributes(), attribute.String(polaris.AttrNamespace, namespace))
+	require.Contains(t, register.Attributes(), attribute.String(polaris.AttrService, serviceName))
+
+	require.Equal(t, "polaris.GetInstances", resolve.Name())
+	require.Equal(t, parent.SpanContext().SpanID(), resolve.Parent().SpanID())
+	require.Contains(t, resolve.Attributes(), attribute.Int(polaris.AttrInstanceCount, 1))
+
+	require.Equal(t, "polaris.Deregister", deregister.Name())
+	require.Equal(t, codes.Error, deregister.Status().Code)
+	require.Contains(t, deregister.Attributes(), attribute.Int(polaris.AttrErrorCode, int(model.ErrCodeNetworkError)))
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/cloudwego/kitex/pkg/registry"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"github.com/cloudwego/kitex/pkg/utils"
+	"github.com/kitex-contrib/registry-polaris/polaristest"
+	"github.com/polarismesh/polaris-go/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+type traceKey struct{}
+
+// recordSpan is a span of recordTracer.
+type recordSpan struct {
+	op, namespace, service string
+	// trace is the traceKey value of the context the span is started in.
+	trace      interface{}
+	attributes map[string]interface{}
+	err        error
+	ended      bool
+}
+
+func (s *recordSpan) SetAttribute(key string, value interface{}) { s.attributes[key] = value }
+func (s *recordSpan) End(err error)                              { s.err, s.ended = err, true }
+
+// recordTracer is a Tracer keeping the spans it started.
+type recordTracer struct {
+	lock  sync.Mutex
+	spans []*recordSpan
+}
+
+func (t *recordTracer) StartSpan(ctx context.Context, op, namespace, service string) (context.Context, Span) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	span := &recordSpan{op: op, namespace: namespace, service: service, trace: ctx.Value(traceKey{}),
+		attributes: make(map[string]interface{})}
+	t.spans = append(t.spans, span)
+	return ctx, span
+}
+
+func TestTracing(t *testing.T) {
+	tracer := &recordTracer{}
+	server := polaristest.NewServer()
+	rg := NewPolarisRegistryByAPI(server.ProviderAPI(), server.ConsumerAPI(), WithRegistryTracing(tracer))
+	rs := NewPolarisResolverByAPI(server.ProviderAPI(), server.ConsumerAPI(), WithResolverTracing(tracer))
+	info := &registry.Info{ServiceName: serviceName, Addr: utils.NewNetAddr("tcp", "127.0.0.1:6666")}
+
+	require.Nil(t, rg.Register(info))
+	ctx := context.WithValue(context.Background(), traceKey{}, "call")
+	desc := rs.Target(ctx, rpcinfo.NewEndpointInfo(serviceName, "", nil, nil))
+	_, err := rs.Resolve(ctx, desc)
+	require.Nil(t, err)
+	server.InjectError(polaristest.OpDeregister, model.NewSDKError(model.ErrCodeNetworkError, nil, "network"), 1)
+	require.NotNil(t, rg.Deregister(info))
+
+	tracer.lock.Lock()
+	defer tracer.lock.Unlock()
+	var spans []*recordSpan
+	for _, span := range tracer.spans {
+		// heartbeats may be sent meanwhile.
+		if span.op != "Heartbeat" {
+			spans = append(spans, span)
+		}
+	}
+	require.Len(t, spans, 3)
+	register, resolve, deregister := spans[0], spans[1], spans[2]
+	require.Equal(t, "Register", register.op)
+	require.Equal(t, polarisDefaultNamespace, register.namespace)
+	require.Equal(t, serviceName, register.service)
+	require.Equal(t, "127.0.0.1", register.attributes[AttrInstanceHost])
+	require.Equal(t, 6666, register.attributes[AttrInstancePort])
+	require.True(t, register.ended)
+	require.Nil(t, register.err)
+
+	require.Equal(t, "GetInstances", resolve.op)
+	require.Equal(t, "call", resolve.trace)
+	require.Equal(t, 1, resolve.attributes[AttrInstanceCount])
+
+	require.Equal(t, "Deregister", deregister.op)
+	require.NotNil(t, deregister.err)
+	require.Equal(t, int(model.ErrCodeNetworkError), deregister.attributes[AttrErrorCode])
+}
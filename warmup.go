@@ -0,0 +1,137 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	defaultWarmupInterval    = 5 * time.Second
+	defaultWarmupStartWeight = 1
+)
+
+// WarmupCurve maps the elapsed fraction of the warm-up window, in [0, 1],
+// to the fraction of the target weight to apply, in [0, 1].
+type WarmupCurve func(progress float64) float64
+
+var (
+	// LinearWarmup raises the weight at a constant rate.
+	LinearWarmup WarmupCurve = func(progress float64) float64 {
+		return progress
+	}
+	// QuadraticWarmup raises the weight slowly at first and faster towards the end.
+	QuadraticWarmup WarmupCurve = func(progress float64) float64 {
+		return progress * progress
+	}
+)
+
+// WarmupConfig describes how a freshly registered instance ramps its weight up
+// from StartWeight to its registered weight, registry.Info.Weight with WithInfoWeight
+// and the polaris default otherwise.
+type WarmupConfig struct {
+	// Duration is the length of the warm-up window.
+	Duration time.Duration
+	// Interval is how often the weight is raised, 5s by default.
+	Interval time.Duration
+	// StartWeight is the weight the instance is registered with, 1 by default.
+	StartWeight int
+	// Curve shapes the ramp, LinearWarmup by default.
+	Curve WarmupCurve
+}
+
+func (c *WarmupConfig) fillDefaults() {
+	if c.Interval <= 0 {
+		c.Interval = defaultWarmupInterval
+	}
+	if c.StartWeight <= 0 {
+		c.StartWeight = defaultWarmupStartWeight
+	}
+	if c.Curve == nil {
+		c.Curve = LinearWarmup
+	}
+}
+
+// weightAt returns the weight to apply once elapsed of duration has passed.
+func (c *WarmupConfig) weightAt(elapsed, duration time.Duration, target int) int {
+	if elapsed >= duration || target <= c.StartWeight {
+		return target
+	}
+	progress := c.Curve(float64(elapsed) / float64(duration))
+	if progress < 0 {
+		progress = 0
+	} else if progress > 1 {
+		progress = 1
+	}
+	return c.StartWeight + int(progress*float64(target-c.StartWeight))
+}
+
+// doWarmup raises the weight of a registered instance until it reaches target.
+// Polaris updates an existing instance in place when it is registered again,
+// so every step is a re-registration carrying the new weight.
+func (svr *polarisRegistry) doWarmup(ctx context.Context, insHeartbeat *polarisHeartbeat, duration time.Duration, target int) {
+	warmup := svr.opts.warmup
+	ticker := time.NewTicker(warmup.Interval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	last := warmup.StartWeight
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			weight := warmup.weightAt(time.Since(start), duration, target)
+			if weight == last {
+				continue
+			}
+			if err := svr.updateWeight(ctx, insHeartbeat, weight); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				svr.opts.logger.Warn("fail to raise warm-up weight",
+					"instance", insHeartbeat.instanceKey, "weight", weight, "err", err)
+				continue
+			}
+			last = weight
+			if weight >= target {
+				return
+			}
+		}
+	}
+}
+
+// updateWeight re-registers the instance with weight and records it as the desired weight.
+func (svr *polarisRegistry) updateWeight(ctx context.Context, insHeartbeat *polarisHeartbeat, weight int) error {
+	insHeartbeat.opLock.Lock()
+	defer insHeartbeat.opLock.Unlock()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	svr.lock.RLock()
+	req := *insHeartbeat.request
+	svr.lock.RUnlock()
+	req.Weight = &weight
+	if _, err := svr.register(ctx, &req); err != nil {
+		return err
+	}
+	svr.lock.Lock()
+	insHeartbeat.request = &req
+	svr.lock.Unlock()
+	return nil
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright 2021 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package polaris
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/registry"
+	"github.com/cloudwego/kitex/pkg/utils"
+	"github.com/kitex-contrib/registry-polaris/polaristest"
+	"github.com/polarismesh/polaris-go/api"
+	"github.com/polarismesh/polaris-go/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarmupWeightAt(t *testing.T) {
+	cfg := WarmupConfig{StartWeight: 10}
+	cfg.fillDefaults()
+	duration := 100 * time.Second
+
+	require.Equal(t, 10, cfg.weightAt(0, duration, 100))
+	require.Equal(t, 55, cfg.weightAt(50*time.Second, duration, 100))
+	require.Equal(t, 100, cfg.weightAt(duration, duration, 100))
+	require.Equal(t, 100, cfg.weightAt(2*duration, duration, 100))
+
+	cfg.Curve = QuadraticWarmup
+	require.Equal(t, 32, cfg.weightAt(50*time.Second, duration, 100))
+}
+
+// weightRecorder records the weights the instances are registered with.
+type weightRecorder struct {
+	api.ProviderAPI
+
+	lock    sync.Mutex
+	weights []int
+}
+
+func (r *weightRecorder) Register(req *api.InstanceRegisterRequest) (*model.InstanceRegisterResponse, error) {
+	r.lock.Lock()
+	weight := 0
+	if req.Weight != nil {
+		weight = *req.Weight
+	}
+	r.weights = append(r.weights, weight)
+	r.lock.Unlock()
+	return r.ProviderAPI.Register(req)
+}
+
+func (r *weightRecorder) recorded() []int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]int(nil), r.weights...)
+}
+
+func TestWarmupRegistersRisingWeights(t *testing.T) {
+	server := polaristest.NewServer()
+	recorder := &weightRecorder{ProviderAPI: server.ProviderAPI()}
+	rg := NewPolarisRegistryByAPI(recorder, server.ConsumerAPI(), WithInfoWeight(),
+		WithWarmup(WarmupConfig{Duration: 50 * time.Millisecond, Interval: 5 * time.Millisecond, StartWeight: 10}))
+	info := &registry.Info{
+		ServiceName: serviceName,
+		Addr:        utils.NewNetAddr("tcp", "127.0.0.1:6666"),
+		Weight:      100,
+	}
+	require.Nil(t, rg.Register(info))
+	defer rg.Deregister(info)
+
+	require.Eventually(t, func() bool {
+		return instanceAt(server, "127.0.0.1", 6666).Weight == 100
+	}, time.Second, time.Millisecond)
+	weights := recorder.recorded()
+	require.Greater(t, len(weights), 2)
+	require.Equal(t, 10, weights[0])
+	require.Equal(t, 100, weights[len(weights)-1])
+	for i := 1; i < len(weights); i++ {
+		require.Greater(t, weights[i], weights[i-1])
+	}
+}
+
+func TestWeightLeftToPolaris(t *testing.T) {
+	server := polaristest.NewServer()
+	recorder := &weightRecorder{ProviderAPI: server.ProviderAPI()}
+	rg := NewPolarisRegistryByAPI(recorder, server.ConsumerAPI())
+	info := &registry.Info{
+		ServiceName: serviceName,
+		Addr:        utils.NewNetAddr("tcp", "127.0.0.1:6666"),
+		Weight:      10,
+	}
+	require.Nil(t, rg.Register(info))
+	defer rg.Deregister(info)
+
+	require.Equal(t, []int{0}, recorder.recorded())
+	require.Equal(t, defaultPolarisWeight, instanceAt(server, "127.0.0.1", 6666).Weight)
+}